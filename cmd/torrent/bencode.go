@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/Phantomape/bittorrent-client/pkg/bencode"
+)
+
+// runBencode : inspect and hand-edit bencoded files like torrents and resume files
+func runBencode(args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected dump or edit")
+	}
+	fs := flag.NewFlagSet("bencode "+args[0], flag.ExitOnError)
+	base64 := fs.Bool("base64", false, "render binary strings as base64 instead of hex")
+	compact := fs.Bool("compact", false, "print compact JSON instead of indenting it")
+	fs.Parse(args[1:])
+
+	opts := bencode.JSONOptions{Base64: *base64, Indent: "  "}
+	if *compact {
+		opts.Indent = ""
+	}
+
+	switch args[0] {
+	case "dump":
+		return bencodeDump(opts, fs.Arg(0))
+	case "edit":
+		if fs.NArg() != 1 {
+			return errors.New("edit needs exactly one file")
+		}
+		return bencodeEdit(opts, fs.Arg(0))
+	}
+	return errors.New("unknown bencode command " + args[0])
+}
+
+// bencodeDump : print a file, or stdin when no file is given, as JSON
+func bencodeDump(opts bencode.JSONOptions, name string) error {
+	r := io.Reader(os.Stdin)
+	if name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	return opts.ToJSON(r, os.Stdout)
+}
+
+// bencodeEdit : open the JSON form of a file in $EDITOR and write back the result
+func bencodeEdit(opts bencode.JSONOptions, name string) error {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile("", filepath.Base(name)+".*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = opts.ToJSON(bytes.NewReader(data), tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	// Go through the shell like git does, EDITOR may carry arguments
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", tmp.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	edited, err := os.Open(tmp.Name())
+	if err != nil {
+		return err
+	}
+	defer edited.Close()
+	var out bytes.Buffer
+	if err := bencode.FromJSON(edited, &out); err != nil {
+		return err
+	}
+	if bytes.Equal(out.Bytes(), data) {
+		return nil
+	}
+	return writeFileAtomic(name, out.Bytes())
+}
+
+// writeFileAtomic : replace a file so that readers never see a partial write
+func writeFileAtomic(name string, data []byte) error {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), fi.Mode()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
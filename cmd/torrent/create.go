@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Phantomape/bittorrent-client/pkg/metainfo"
+)
+
+// stringsFlag : a flag that can be given several times
+type stringsFlag []string
+
+func (sf *stringsFlag) String() string {
+	return strings.Join(*sf, " ")
+}
+
+func (sf *stringsFlag) Set(s string) error {
+	*sf = append(*sf, s)
+	return nil
+}
+
+// runCreate : create a .torrent for a file or directory
+func runCreate(args []string) error {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	var announce, webSeeds stringsFlag
+	fs.Var(&announce, "a", "tracker tier, comma separated URLs; repeat for more tiers")
+	fs.Var(&webSeeds, "w", "web seed URL; repeat for more")
+	output := fs.String("o", "", "output file, name.torrent if empty, - for stdout")
+	name := fs.String("n", "", "torrent name, the base name of the path if empty")
+	comment := fs.String("c", "", "comment")
+	private := fs.Bool("private", false, "mark the torrent private, BEP 27")
+	source := fs.String("source", "", "source tag, gives the torrent a distinct infohash")
+	pieceLength := fs.Int64("piece-length", 0, "piece length in bytes, chosen from the total size if 0")
+	noDate := fs.Bool("no-date", false, "leave out the creation date, for reproducible output")
+	workers := fs.Int("workers", 0, "goroutines hashing pieces, the number of CPUs if 0")
+	version := fs.String("version", "1", "torrent version: 1, 2 or hybrid, BEP 52")
+	pad := fs.Bool("pad", false, "align files to piece boundaries with padding files, BEP 47")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("expected exactly one file or directory")
+	}
+
+	b := metainfo.Builder{
+		Path:        fs.Arg(0),
+		Name:        *name,
+		PieceLength: *pieceLength,
+		Comment:     *comment,
+		CreatedBy:   "bittorrent-client",
+		Private:     *private,
+		Source:      *source,
+		URLList:     webSeeds,
+		Workers:     *workers,
+		PadFiles:    *pad,
+	}
+	switch *version {
+	case "1":
+		b.Version = metainfo.V1
+	case "2":
+		b.Version = metainfo.V2
+	case "hybrid":
+		b.Version = metainfo.Hybrid
+	default:
+		return fmt.Errorf("unknown torrent version %q", *version)
+	}
+	for _, tier := range announce {
+		b.AnnounceList = append(b.AnnounceList, strings.Split(tier, ","))
+	}
+	if !*noDate {
+		b.CreationDate = time.Now().Unix()
+	}
+	if b.PieceLength != 0 && b.PieceLength&(b.PieceLength-1) != 0 {
+		return fmt.Errorf("piece length %d is not a power of two", b.PieceLength)
+	}
+
+	mi, err := b.Build()
+	if err != nil {
+		return err
+	}
+
+	if *output == "-" {
+		return mi.Write(os.Stdout)
+	}
+	if *output == "" {
+		base := b.Name
+		if base == "" {
+			base = filepath.Base(filepath.Clean(b.Path))
+		}
+		*output = base + ".torrent"
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	err = mi.Write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if b.Version != metainfo.V2 {
+		fmt.Fprintf(os.Stderr, "wrote %s, infohash %s\n", *output, mi.HashInfoBytes())
+	}
+	if b.Version != metainfo.V1 {
+		fmt.Fprintf(os.Stderr, "wrote %s, v2 infohash %s\n", *output, mi.HashInfoBytesV2())
+	}
+	return nil
+}
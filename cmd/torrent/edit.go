@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/Phantomape/bittorrent-client/pkg/bencode"
+	"github.com/Phantomape/bittorrent-client/pkg/metainfo"
+)
+
+// runEdit : change the trackers, comment and web seeds of a torrent, which
+// keeps its infohash, or its private flag and source, which don't
+func runEdit(args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ExitOnError)
+	var announce, webSeeds stringsFlag
+	fs.Var(&announce, "a", "tracker tier replacing the trackers, comma separated URLs; repeat for more tiers")
+	noTrackers := fs.Bool("no-trackers", false, "remove all trackers")
+	fs.Var(&webSeeds, "w", "web seed URL replacing the web seeds; repeat for more")
+	noWebSeeds := fs.Bool("no-web-seeds", false, "remove all web seeds")
+	comment := fs.String("c", "", "comment, removed if empty")
+	private := fs.Bool("private", false, "set or clear the private flag, changes the infohash")
+	source := fs.String("source", "", "source tag, removed if empty; changes the infohash")
+	output := fs.String("o", "", "output file, the input file is replaced if empty, - for stdout")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("expected exactly one torrent file")
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	name := fs.Arg(0)
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	mi, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return err
+	}
+	oldHash, oldHashV2 := mi.HashInfoBytes(), mi.HashInfoBytesV2()
+
+	// Only the keys edited are re-encoded, the others stay as they were
+	var edited []string
+	switch {
+	case *noTrackers:
+		mi.SetAnnounceList(nil)
+		edited = append(edited, "announce", "announce-list")
+	case len(announce) != 0:
+		var al metainfo.AnnounceList
+		for _, tier := range announce {
+			al = append(al, strings.Split(tier, ","))
+		}
+		mi.SetAnnounceList(al)
+		edited = append(edited, "announce", "announce-list")
+	}
+	switch {
+	case *noWebSeeds:
+		mi.URLList = nil
+		edited = append(edited, "url-list")
+	case len(webSeeds) != 0:
+		mi.URLList = metainfo.URLList(webSeeds)
+		edited = append(edited, "url-list")
+	}
+	if set["c"] {
+		mi.Comment = *comment
+		edited = append(edited, "comment")
+	}
+
+	// Only an edit of the info dictionary may touch its bytes
+	changed := false
+	if set["private"] || set["source"] {
+		var edit metainfo.InfoEdit
+		if set["private"] {
+			edit.Private = private
+		}
+		if set["source"] {
+			edit.Source = source
+		}
+		if changed, err = mi.EditInfo(edit); err != nil {
+			return err
+		}
+	}
+	if changed {
+		edited = append(edited, "info")
+		// Anyone with the original torrent won't find the edited one
+		if info.HasV1() {
+			fmt.Fprintf(os.Stderr, "warning: the info dictionary changed, infohash %s is now %s\n", oldHash, mi.HashInfoBytes())
+		}
+		if info.HasV2() {
+			fmt.Fprintf(os.Stderr, "warning: the info dictionary changed, v2 infohash %s is now %s\n", oldHashV2, mi.HashInfoBytesV2())
+		}
+	}
+
+	out, err := mergeEdited(data, mi, edited)
+	if err != nil {
+		return err
+	}
+	switch *output {
+	case "-":
+		_, err = os.Stdout.Write(out)
+		return err
+	case "":
+		if bytes.Equal(out, data) {
+			return nil
+		}
+		return writeFileAtomic(name, out)
+	}
+	return ioutil.WriteFile(*output, out, 0644)
+}
+
+// mergeEdited : the torrent file data with the keys taken from mi. The
+// other keys are kept byte for byte, including those MetaInfo doesn't know
+// about or would encode differently, like a url-list that is a single string.
+func mergeEdited(data []byte, mi *metainfo.MetaInfo, keys []string) ([]byte, error) {
+	if len(keys) == 0 {
+		return data, nil
+	}
+	var orig, edited map[string]bencode.Bytes
+	if err := bencode.Unmarshal(data, &orig); err != nil {
+		return nil, err
+	}
+	b, err := bencode.Marshal(mi)
+	if err != nil {
+		return nil, err
+	}
+	if err := bencode.Unmarshal(b, &edited); err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if v, ok := edited[k]; ok {
+			orig[k] = v
+		} else {
+			delete(orig, k)
+		}
+	}
+	return bencode.Marshal(orig)
+}
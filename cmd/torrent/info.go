@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Phantomape/bittorrent-client/pkg/metainfo"
+)
+
+// torrentInfo : what info prints about a torrent file or magnet link, also
+// its JSON output
+type torrentInfo struct {
+	InfoHash     string              `json:"info_hash,omitempty"`
+	InfoHashV2   string              `json:"info_hash_v2,omitempty"`
+	Name         string              `json:"name,omitempty"`
+	TotalLength  int64               `json:"total_length,omitempty"`
+	PieceLength  int64               `json:"piece_length,omitempty"`
+	NumPieces    int                 `json:"num_pieces,omitempty"`
+	Files        []fileInfo          `json:"files,omitempty"`
+	Trackers     [][]string          `json:"trackers,omitempty"` // tiers
+	WebSeeds     []string            `json:"web_seeds,omitempty"`
+	Peers        []string            `json:"peers,omitempty"`       // magnet links only
+	SelectOnly   []int               `json:"select_only,omitempty"` // magnet links only
+	Private      bool                `json:"private,omitempty"`
+	Source       string              `json:"source,omitempty"`
+	Comment      string              `json:"comment,omitempty"`
+	CreatedBy    string              `json:"created_by,omitempty"`
+	CreationDate *time.Time          `json:"creation_date,omitempty"`
+	Magnet       string              `json:"magnet"`
+	Problems     []metainfo.Problem  `json:"-"`
+	ProblemMsgs  []string            `json:"problems,omitempty"`
+	Extra        map[string][]string `json:"magnet_params,omitempty"` // unknown magnet parameters
+
+	isDir bool // the files are in a directory named like the torrent
+}
+
+// fileInfo : a file of the torrent, padding files are left out
+type fileInfo struct {
+	Path   []string `json:"path"`
+	Length int64    `json:"length"`
+	Attr   string   `json:"attr,omitempty"`
+}
+
+// runInfo : print what a torrent file or magnet link describes
+func runInfo(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "print JSON")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("expected exactly one torrent file or magnet link")
+	}
+
+	var ti torrentInfo
+	var err error
+	if arg := fs.Arg(0); strings.HasPrefix(arg, "magnet:") {
+		ti, err = magnetInfo(arg)
+	} else {
+		ti, err = fileTorrentInfo(arg)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		for _, p := range ti.Problems {
+			ti.ProblemMsgs = append(ti.ProblemMsgs, p.Error())
+		}
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		e.SetEscapeHTML(false)
+		return e.Encode(ti)
+	}
+	printInfo(os.Stdout, &ti)
+	return nil
+}
+
+// fileTorrentInfo : load a torrent file
+func fileTorrentInfo(name string) (ti torrentInfo, err error) {
+	var mi *metainfo.MetaInfo
+	if name == "-" {
+		mi, err = metainfo.Load(os.Stdin)
+	} else {
+		mi, err = metainfo.LoadFromFile(name)
+	}
+	if err != nil {
+		return
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return
+	}
+	m, err := mi.Magnet()
+	if err != nil {
+		return
+	}
+
+	if info.HasV1() {
+		ti.InfoHash = mi.HashInfoBytes().HexString()
+	}
+	if info.HasV2() {
+		ti.InfoHashV2 = mi.HashInfoBytesV2().HexString()
+	}
+	ti.Name = info.Name
+	if info.NameUTF8 != "" {
+		ti.Name = info.NameUTF8
+	}
+	ti.isDir = info.IsDir()
+	ti.PieceLength = info.PieceLength
+	if info.PieceLength > 0 {
+		ti.NumPieces = info.NumPieces()
+	}
+	for _, fi := range info.VisibleFiles() {
+		path := fi.Path
+		if len(fi.PathUTF8) != 0 {
+			path = fi.PathUTF8
+		}
+		if !info.IsDir() {
+			path = []string{ti.Name}
+		}
+		ti.Files = append(ti.Files, fileInfo{path, fi.Length, fi.Attr})
+		// Padding files don't count, they are never downloaded
+		ti.TotalLength += fi.Length
+	}
+	ti.Trackers = mi.UpvertedAnnounceList()
+	ti.WebSeeds = append(ti.WebSeeds, mi.URLList...)
+	ti.WebSeeds = append(ti.WebSeeds, mi.HTTPSeeds...)
+	ti.Private = info.IsPrivate()
+	ti.Source = info.Source
+	ti.Comment = mi.Comment
+	ti.CreatedBy = mi.CreatedBy
+	if mi.CreationDate != 0 {
+		t := time.Unix(mi.CreationDate, 0).UTC()
+		ti.CreationDate = &t
+	}
+	ti.Magnet = m.String()
+	ti.Problems = info.Validate()
+	return
+}
+
+// magnetInfo : the little a magnet link tells about a torrent
+func magnetInfo(uri string) (ti torrentInfo, err error) {
+	m, err := metainfo.ParseMagnet(uri)
+	if err != nil {
+		return
+	}
+	if !m.InfoHash.IsZero() {
+		ti.InfoHash = m.InfoHash.HexString()
+	}
+	if !m.InfoHashV2.IsZero() {
+		ti.InfoHashV2 = m.InfoHashV2.HexString()
+	}
+	ti.Name = m.DisplayName
+	// Like most clients, each tracker of a magnet link is a tier of its own
+	for _, tr := range m.Trackers {
+		ti.Trackers = append(ti.Trackers, []string{tr})
+	}
+	ti.WebSeeds = m.WebSeeds
+	ti.Peers = m.Peers
+	ti.SelectOnly = m.SelectOnly
+	ti.Magnet = m.String()
+	ti.Extra = m.Params
+	return
+}
+
+// printInfo : print the human readable form of ti
+func printInfo(w io.Writer, ti *torrentInfo) {
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%-14s %s\n", name+":", value)
+		}
+	}
+	field("Name", ti.Name)
+	field("Info hash", ti.InfoHash)
+	field("Info hash v2", ti.InfoHashV2)
+	if ti.PieceLength != 0 {
+		field("Total size", fmt.Sprintf("%s (%d bytes)", formatSize(ti.TotalLength), ti.TotalLength))
+		field("Piece length", formatSize(ti.PieceLength))
+		field("Pieces", fmt.Sprint(ti.NumPieces))
+		private := "no"
+		if ti.Private {
+			private = "yes"
+		}
+		field("Private", private)
+	}
+	field("Source", ti.Source)
+	field("Comment", ti.Comment)
+	field("Created by", ti.CreatedBy)
+	if ti.CreationDate != nil {
+		field("Created on", ti.CreationDate.Format(time.RFC3339))
+	}
+	field("Magnet", ti.Magnet)
+
+	if len(ti.Trackers) != 0 {
+		fmt.Fprintln(w, "\nTrackers:")
+		for i, tier := range ti.Trackers {
+			fmt.Fprintf(w, "  tier %d: %s\n", i+1, strings.Join(tier, " "))
+		}
+	}
+	if len(ti.WebSeeds) != 0 {
+		fmt.Fprintln(w, "\nWeb seeds:")
+		for _, ws := range ti.WebSeeds {
+			fmt.Fprintln(w, "  "+ws)
+		}
+	}
+	if len(ti.Peers) != 0 {
+		fmt.Fprintln(w, "\nPeers:")
+		for _, pe := range ti.Peers {
+			fmt.Fprintln(w, "  "+pe)
+		}
+	}
+	if len(ti.SelectOnly) != 0 {
+		fmt.Fprintf(w, "\nSelected files: %v\n", ti.SelectOnly)
+	}
+	if len(ti.Extra) != 0 {
+		fmt.Fprintln(w, "\nOther magnet parameters:")
+		for k, vs := range ti.Extra {
+			for _, v := range vs {
+				fmt.Fprintf(w, "  %s=%s\n", k, v)
+			}
+		}
+	}
+	if len(ti.Files) != 0 {
+		fmt.Fprintln(w, "\nFiles:")
+		printFileTree(w, ti)
+	}
+	if len(ti.Problems) != 0 {
+		fmt.Fprintln(w, "\nProblems:")
+		for _, p := range ti.Problems {
+			fmt.Fprintf(w, "  %s: %s\n", p.Field, p.Msg)
+		}
+	}
+}
+
+// printFileTree : print the files indented under their directories, the
+// files of a directory torrent under a directory named like the torrent
+func printFileTree(w io.Writer, ti *torrentInfo) {
+	var dir []string // directory of the previous file
+	for _, f := range ti.Files {
+		path := f.Path
+		if ti.isDir {
+			path = append([]string{ti.Name}, f.Path...)
+		}
+		// Print the directories that weren't printed for the previous file
+		common := 0
+		for common < len(dir) && common < len(path)-1 && dir[common] == path[common] {
+			common++
+		}
+		for i := common; i < len(path)-1; i++ {
+			fmt.Fprintf(w, "  %s%s/\n", strings.Repeat("  ", i), path[i])
+		}
+		dir = path[:len(path)-1]
+
+		name := path[len(path)-1]
+		if f.Attr != "" {
+			name += " [" + f.Attr + "]"
+		}
+		fmt.Fprintf(w, "  %s%-*s %10s\n", strings.Repeat("  ", len(dir)), 40-2*len(dir), name, formatSize(f.Length))
+	}
+}
+
+// formatSize : a byte count in binary units
+func formatSize(n int64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	f, i := float64(n)/1024, 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", f, units[i])
+}
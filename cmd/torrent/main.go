@@ -1,5 +1,48 @@
 package main
 
-func main() {
+import (
+	"fmt"
+	"os"
+)
+
+// command : a subcommand of the torrent tool
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"bencode", "bencode dump|edit [flags] [file]", runBencode},
+	{"create", "create [flags] path", runCreate},
+	{"edit", "edit [flags] file.torrent", runEdit},
+	{"info", "info [-json] file.torrent|magnet", runInfo},
+	{"scrape", "scrape [flags] file.torrent|magnet...", runScrape},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: torrent <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintln(os.Stderr, "  torrent "+c.usage)
+	}
+}
 
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+		if err := c.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "torrent %s: %s\n", c.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	usage()
+	os.Exit(2)
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Phantomape/bittorrent-client/pkg/metainfo"
+	"github.com/Phantomape/bittorrent-client/pkg/tracker"
+)
+
+// runScrape : print the seeders, leechers and completed downloads trackers
+// report for torrents, without joining their swarms
+func runScrape(args []string) error {
+	fs := flag.NewFlagSet("scrape", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 30*time.Second, "give up on a tracker after this long")
+	var trackers stringsFlag
+	fs.Var(&trackers, "t", "tracker to scrape instead of those of the torrents, repeatable")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("expected torrent files or magnet links")
+	}
+
+	// The torrents each tracker knows, so a tracker is asked about all of
+	// them at once
+	var urls []string
+	byTracker := make(map[string][]metainfo.Magnet)
+	for _, arg := range fs.Args() {
+		m, err := loadMagnet(arg)
+		if err != nil {
+			return fmt.Errorf("%s: %w", arg, err)
+		}
+		trs := m.Trackers
+		if len(trackers) != 0 {
+			trs = trackers
+		}
+		for _, tr := range trs {
+			if _, ok := byTracker[tr]; !ok {
+				urls = append(urls, tr)
+			}
+			byTracker[tr] = append(byTracker[tr], m)
+		}
+	}
+	if len(urls) == 0 {
+		return errors.New("no trackers to scrape")
+	}
+
+	failed := 0
+	for _, u := range urls {
+		ms := byTracker[u]
+		infoHashes := make([][20]byte, len(ms))
+		for i, m := range ms {
+			infoHashes[i] = m.WireHash()
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		res, err := tracker.ScrapeContext(ctx, u, infoHashes...)
+		cancel()
+		fmt.Println(u)
+		if err != nil {
+			fmt.Printf("  error: %s\n", err)
+			failed++
+			continue
+		}
+		for i, r := range res {
+			fmt.Printf("  %x  seeders %d  leechers %d  completed %d  %s\n",
+				infoHashes[i], r.Seeders, r.Leechers, r.Completed, ms[i].DisplayName)
+		}
+	}
+	if failed == len(urls) {
+		return errors.New("no tracker answered")
+	}
+	return nil
+}
+
+// loadMagnet : the magnet link of a torrent file, or a magnet link itself
+func loadMagnet(arg string) (m metainfo.Magnet, err error) {
+	if strings.HasPrefix(arg, "magnet:") {
+		return metainfo.ParseMagnet(arg)
+	}
+	var mi *metainfo.MetaInfo
+	if arg == "-" {
+		mi, err = metainfo.Load(os.Stdin)
+	} else {
+		mi, err = metainfo.LoadFromFile(arg)
+	}
+	if err != nil {
+		return
+	}
+	return mi.Magnet()
+}
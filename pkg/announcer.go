@@ -0,0 +1,70 @@
+package bittorrentclient
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/Phantomape/bittorrent-client/pkg/tracker"
+)
+
+// torrentAnnouncer : the torrent as the target of its tracker.Announcer
+type torrentAnnouncer struct {
+	t *Torrent
+}
+
+// AnnounceRequest : the transfer counters of the torrent
+func (ta torrentAnnouncer) AnnounceRequest() tracker.AnnounceRequest {
+	t, c := ta.t, ta.t.c
+	c.rLock()
+	defer c.rUnlock()
+	return tracker.AnnounceRequest{
+		InfoHash:   t.infoHash,
+		PeerID:     c.peerID,
+		Downloaded: atomic.LoadInt64(&t.bytesDownloaded),
+		Left:       uint64(t.bytesLeft()),
+		Uploaded:   atomic.LoadInt64(&t.bytesUploaded),
+		Key:        c.announceKey,
+		Port:       uint16(c.LocalPort()),
+	}
+}
+
+// AddPeers : connect to the peers a tracker returned
+func (ta torrentAnnouncer) AddPeers(peers []tracker.Peer) {
+	ta.t.c.lock()
+	defer ta.t.c.unlock()
+	ta.t.addPeers(peers, peerSourceTracker)
+}
+
+// addTrackers : add the tiers of trackers the torrent doesn't have yet, and
+// start announcing, with the client locked
+func (t *Torrent) addTrackers(tiers [][]string) {
+	t.announcer.AddTiers(tiers)
+	t.startAnnouncing()
+}
+
+// Trackers : the announce URLs of the torrent in tiers, in the order they are
+// tried
+func (t *Torrent) Trackers() [][]string {
+	return t.announcer.Tiers()
+}
+
+// TrackerStatus : how the announces to each tracker of the torrent went, in
+// the order the trackers are tried
+func (t *Torrent) TrackerStatus() []tracker.Status {
+	return t.announcer.Status()
+}
+
+// startAnnouncing : start the announcer once the torrent has trackers, with
+// the client locked. It runs until the torrent closes.
+func (t *Torrent) startAnnouncing() {
+	if t.stopAnnouncing != nil || len(t.announcer.Tiers()) == 0 || t.closed.IsSet() {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.stopAnnouncing = cancel
+	t.c.announcers.Add(1)
+	go func() {
+		defer t.c.announcers.Done()
+		t.announcer.Run(ctx)
+	}()
+}
@@ -0,0 +1,31 @@
+package bencode
+
+import "errors"
+
+// Bytes is a raw encoded BENCODE value. It is passed through Marshal and
+// Unmarshal verbatim, which lets a caller keep the exact encoding of a value,
+// e.g. the info dictionary of a torrent that the infohash is computed over.
+// It is the equivalent of json.RawMessage.
+type Bytes []byte
+
+var (
+	_ Marshaler   = Bytes(nil)
+	_ Unmarshaler = (*Bytes)(nil)
+)
+
+// MarshalBENCODE returns b as the BENCODE encoding of b.
+func (b Bytes) MarshalBENCODE() ([]byte, error) {
+	if b == nil {
+		return nil, errors.New("bencode.Bytes: MarshalBENCODE on nil value")
+	}
+	return b, nil
+}
+
+// UnmarshalBENCODE sets *b to a copy of data.
+func (b *Bytes) UnmarshalBENCODE(data []byte) error {
+	if b == nil {
+		return errors.New("bencode.Bytes: UnmarshalBENCODE on nil pointer")
+	}
+	*b = append((*b)[0:0], data...)
+	return nil
+}
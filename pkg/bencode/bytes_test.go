@@ -0,0 +1,58 @@
+package bencode
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestBytesRoundTrip(t *testing.T) {
+	type wrapper struct {
+		A Bytes `bencode:"a"`
+		B int   `bencode:"b"`
+	}
+	// Every kind of value is kept verbatim, including non-canonical ints
+	for _, raw := range []string{"i007e", "3:abc", "li1e1:xe", "d1:xi1ee"} {
+		in := []byte("d1:a" + raw + "1:bi2ee")
+		var w wrapper
+		if err := Unmarshal(in, &w); err != nil {
+			t.Fatalf("Unmarshal(%q): %v", in, err)
+		}
+		if string(w.A) != raw || w.B != 2 {
+			t.Errorf("Unmarshal(%q) = %+v", in, w)
+		}
+		out, err := Marshal(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, in) {
+			t.Errorf("Marshal = %q, want %q", out, in)
+		}
+	}
+}
+
+func TestBytesInvalid(t *testing.T) {
+	for _, b := range []Bytes{nil, Bytes("i1"), Bytes("i1ei2e")} {
+		if _, err := Marshal(b); err == nil {
+			t.Errorf("Marshal(%q): expected error", b)
+		} else if _, ok := err.(*MarshalerError); !ok {
+			t.Errorf("Marshal(%q): got %T, want *MarshalerError", b, err)
+		}
+	}
+}
+
+func TestBytesInfoDictionary(t *testing.T) {
+	data, err := ioutil.ReadFile("../../test/data/bootstrap.dat.torrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mi struct {
+		Info Bytes `bencode:"info"`
+	}
+	if err := Unmarshal(data, &mi); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("4:info"+string(mi.Info))) {
+		t.Error("info dictionary is not the original span of the input")
+	}
+}
@@ -1,8 +1,13 @@
 package bencode
 
 import (
+	"bytes"
 	"encoding"
+	"errors"
+	"math/big"
 	"reflect"
+	"strconv"
+	"sync"
 )
 
 const phasePanicMsg = "BENCODE decoder out of sync - data changing underfoot?"
@@ -59,7 +64,10 @@ func indirect(v reflect.Value, decodingNull bool) (Unmarshaler, encoding.TextUnm
 	return nil, nil, v
 }
 
-// Unmarshaler implement UnmarshalBENCODE([]byte)
+// Unmarshaler is the interface implemented by types that can unmarshal a
+// BENCODE description of themselves. The input is the complete encoding of a
+// single value of any kind. UnmarshalBENCODE must copy the data if it wishes
+// to retain the data after returning.
 type Unmarshaler interface {
 	UnmarshalBENCODE([]byte) error
 }
@@ -83,14 +91,16 @@ func (e *InvalidUnmarshalError) Error() string {
 // decodeState represents the state while decoding a BENCODE value.
 type decodeState struct {
 	data         []byte
-	off          int
-	opcode       int
+	off          int // next read offset in data
+	opcode       int // last read result
 	scan         scanner
 	savedError   error
 	errorContext struct {
 		Struct reflect.Type
 		Field  string
 	}
+	path []pathElem // lists and dictionaries being decoded, for errors
+	base int64      // offset of data in the input, for errors
 }
 
 func (d *decodeState) init(data []byte) *decodeState {
@@ -99,6 +109,8 @@ func (d *decodeState) init(data []byte) *decodeState {
 	d.savedError = nil
 	d.errorContext.Struct = nil
 	d.errorContext.Field = ""
+	d.path = d.path[:0]
+	d.base = 0
 	return d
 }
 
@@ -110,14 +122,16 @@ func (d *decodeState) unmarshal(v interface{}) error {
 	}
 
 	d.scan.reset()
-	d.scanWhile(scanSkipSpace)
-	err := d.value(rv)
-	if err != nil {
-		return d.addErrorContext(err)
+	d.scanNext()
+	if err := d.value(rv); err != nil {
+		return err
 	}
 	return d.savedError
 }
 
+// value consumes a BENCODE value from d.data[d.off-1:], decoding into v, and
+// reads the following byte ahead. If v is invalid, the value is discarded.
+// The first byte of the value has been read already.
 func (d *decodeState) value(v reflect.Value) error {
 	switch d.opcode {
 	default:
@@ -133,6 +147,23 @@ func (d *decodeState) value(v reflect.Value) error {
 			d.skip()
 		}
 		d.scanNext()
+	case scanBeginDict:
+		if v.IsValid() {
+			if err := d.dict(v); err != nil {
+				return err
+			}
+		} else {
+			d.skip()
+		}
+		d.scanNext()
+	case scanBeginInt, scanBeginBytes:
+		start := d.readIndex()
+		d.rescanLiteral()
+		if v.IsValid() {
+			if err := d.literalStore(d.data[start:d.readIndex()], v, start); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -154,10 +185,10 @@ func (d *decodeState) list(v reflect.Value) error {
 	if u != nil {
 		start := d.readIndex()
 		d.skip()
-		return u.UnmarshalBENCODE(d.data[start:d.off])
+		return d.unmarshalerError(u.UnmarshalBENCODE(d.data[start:d.off]), start)
 	}
 	if tu != nil {
-		d.saveError(&UnmarshalTypeError{Value: "list", Type: v.Type(), Offset: int64(d.off)})
+		d.saveError(&UnmarshalTypeError{Value: "list", Type: v.Type(), Offset: int64(d.readIndex())})
 		d.skip()
 		return nil
 	}
@@ -166,27 +197,27 @@ func (d *decodeState) list(v reflect.Value) error {
 	switch v.Kind() {
 	case reflect.Interface:
 		if v.NumMethod() == 0 {
-			// TODO: wtf is here
+			// Decoding into nil interface, switch to non-reflect code.
+			li := d.listInterface()
+			v.Set(reflect.ValueOf(li))
 			return nil
 		}
 		fallthrough
 	default:
-		d.saveError(&UnmarshalTypeError{Value: "list", Type: v.Type(), Offset: int64(d.off)})
+		d.saveError(&UnmarshalTypeError{Value: "list", Type: v.Type(), Offset: int64(d.readIndex())})
 		d.skip()
 		return nil
-	// I don't know what these two lines do
 	case reflect.Array, reflect.Slice:
 		break
 	}
 
+	d.path = append(d.path, pathElem{list: true, index: -1})
 	i := 0
-	for {
-		d.scanWhile(scanSkipSpace)
-		if d.opcode == scanEndList {
-			break
-		}
+	d.scanNext()
+	for d.opcode != scanEndList {
+		d.path[len(d.path)-1].index = i
 
-		// Wtf is here doing
+		// Grow the slice if necessary
 		if v.Kind() == reflect.Slice {
 			if i >= v.Cap() {
 				newCap := v.Cap() + v.Cap()/2
@@ -203,26 +234,19 @@ func (d *decodeState) list(v reflect.Value) error {
 		}
 
 		if i < v.Len() {
+			// Decode into element.
 			if err := d.value(v.Index(i)); err != nil {
 				return err
 			}
 		} else {
+			// Ran out of fixed array: skip.
 			if err := d.value(reflect.Value{}); err != nil {
 				return err
 			}
 		}
 		i++
-
-		if d.opcode == scanSkipSpace {
-			d.scanWhile(scanSkipSpace)
-		}
-		if d.opcode == scanEndList {
-			break
-		}
-		if d.opcode != scanListValue {
-			panic(phasePanicMsg)
-		}
 	}
+	d.path = d.path[:len(d.path)-1]
 
 	if i < v.Len() {
 		if v.Kind() == reflect.Array {
@@ -241,6 +265,323 @@ func (d *decodeState) list(v reflect.Value) error {
 	return nil
 }
 
+// dict decodes a dictionary into a struct or a map with string keys
+func (d *decodeState) dict(v reflect.Value) error {
+	u, tu, rv := indirect(v, false)
+	if u != nil {
+		start := d.readIndex()
+		d.skip()
+		return d.unmarshalerError(u.UnmarshalBENCODE(d.data[start:d.off]), start)
+	}
+	if tu != nil {
+		d.saveError(&UnmarshalTypeError{Value: "dict", Type: v.Type(), Offset: int64(d.readIndex())})
+		d.skip()
+		return nil
+	}
+	v = rv
+	t := v.Type()
+
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		// Decoding into nil interface, switch to non-reflect code.
+		di := d.dictInterface()
+		v.Set(reflect.ValueOf(di))
+		return nil
+	}
+
+	var fields map[string]encodeField
+	switch v.Kind() {
+	case reflect.Map:
+		// Bencode dictionary keys are byte strings, so the map key must be a string kind
+		if t.Key().Kind() != reflect.String {
+			d.saveError(&UnmarshalTypeError{Value: "dict", Type: t, Offset: int64(d.readIndex())})
+			d.skip()
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(t))
+		}
+	case reflect.Struct:
+		fields = decodeFields(t)
+	default:
+		d.saveError(&UnmarshalTypeError{Value: "dict", Type: t, Offset: int64(d.readIndex())})
+		d.skip()
+		return nil
+	}
+
+	var mapElem reflect.Value
+	origErrorContext := d.errorContext
+
+	d.path = append(d.path, pathElem{})
+	d.scanNext()
+	for d.opcode != scanEndDict {
+		if d.opcode != scanBeginBytes {
+			panic(phasePanicMsg)
+		}
+
+		// Read the key
+		start := d.readIndex()
+		d.rescanLiteral()
+		key := bytesContent(d.data[start:d.readIndex()])
+		d.path[len(d.path)-1].key = key
+
+		// Figure out the field corresponding to the key
+		var subv reflect.Value
+		ignoreTypeError := false
+		if v.Kind() == reflect.Map {
+			elemType := t.Elem()
+			if !mapElem.IsValid() {
+				mapElem = reflect.New(elemType).Elem()
+			} else {
+				mapElem.Set(reflect.Zero(elemType))
+			}
+			subv = mapElem
+		} else if f, ok := fields[string(key)]; ok {
+			subv = fieldByIndexAlloc(v, f.index)
+			d.errorContext.Struct = t
+			d.errorContext.Field = f.tag
+			ignoreTypeError = f.ignoreUnmarshalTypeError
+		}
+
+		savedError := d.savedError
+		if err := d.value(subv); err != nil {
+			return err
+		}
+		if _, ok := d.savedError.(*UnmarshalTypeError); ok && ignoreTypeError && savedError == nil {
+			d.savedError = nil
+		}
+
+		if v.Kind() == reflect.Map {
+			kv := reflect.ValueOf(string(key)).Convert(t.Key())
+			v.SetMapIndex(kv, subv)
+		}
+		d.errorContext = origErrorContext
+	}
+	d.path = d.path[:len(d.path)-1]
+	return nil
+}
+
+// fieldByIndexAlloc is like v.FieldByIndex, but allocates nil pointers to
+// inlined structs on the way. It returns the invalid Value, which makes the
+// decoder skip the field, when such a pointer can't be set.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+var decodeFieldsCache sync.Map // map[reflect.Type]map[string]encodeField
+
+// decodeFields indexes the fields of a struct type by their dictionary key
+func decodeFields(t reflect.Type) map[string]encodeField {
+	if m, ok := decodeFieldsCache.Load(t); ok {
+		return m.(map[string]encodeField)
+	}
+	fs := encodeFields(t)
+	m := make(map[string]encodeField, len(fs))
+	for _, f := range fs {
+		m[f.tag] = f
+	}
+	mi, _ := decodeFieldsCache.LoadOrStore(t, m)
+	return mi.(map[string]encodeField)
+}
+
+// bytesContent strips the length prefix from an encoded byte string
+func bytesContent(item []byte) []byte {
+	return item[bytes.IndexByte(item, ':')+1:]
+}
+
+// literalStore decodes an integer or byte string item, found at offset start
+// of the data, into v
+func (d *decodeState) literalStore(item []byte, v reflect.Value, start int) error {
+	isInt := item[0] == 'i'
+	valueName := "string"
+	if isInt {
+		valueName = "number"
+	}
+
+	u, tu, pv := indirect(v, false)
+	if u != nil {
+		return d.unmarshalerError(u.UnmarshalBENCODE(item), start)
+	}
+	if tu != nil {
+		if isInt {
+			// *big.Int is a TextUnmarshaler too, but it holds integers of any size
+			if bi, ok := tu.(*big.Int); ok {
+				bi.SetString(string(item[1:len(item)-1]), 10)
+				return nil
+			}
+			d.saveError(&UnmarshalTypeError{Value: valueName, Type: v.Type(), Offset: int64(start)})
+			return nil
+		}
+		return tu.UnmarshalText(bytesContent(item))
+	}
+	v = pv
+
+	if isInt {
+		s := string(item[1 : len(item)-1])
+		switch v.Kind() {
+		default:
+			d.saveError(&UnmarshalTypeError{Value: "number " + s, Type: v.Type(), Offset: int64(start)})
+		case reflect.Interface:
+			if v.NumMethod() != 0 {
+				d.saveError(&UnmarshalTypeError{Value: "number " + s, Type: v.Type(), Offset: int64(start)})
+				break
+			}
+			v.Set(reflect.ValueOf(convertInt(s)))
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || v.OverflowInt(n) {
+				d.saveError(&UnmarshalTypeError{Value: "number " + s, Type: v.Type(), Offset: int64(start)})
+				break
+			}
+			v.SetInt(n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			n, err := strconv.ParseUint(s, 10, 64)
+			if err != nil || v.OverflowUint(n) {
+				d.saveError(&UnmarshalTypeError{Value: "number " + s, Type: v.Type(), Offset: int64(start)})
+				break
+			}
+			v.SetUint(n)
+		case reflect.Bool:
+			// Bencode has no booleans, they are encoded as i0e and i1e
+			v.SetBool(s != "0")
+		}
+		return nil
+	}
+
+	content := bytesContent(item)
+	switch v.Kind() {
+	default:
+		d.saveError(&UnmarshalTypeError{Value: valueName, Type: v.Type(), Offset: int64(start)})
+	case reflect.String:
+		v.SetString(string(content))
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			d.saveError(&UnmarshalTypeError{Value: valueName, Type: v.Type(), Offset: int64(start)})
+			break
+		}
+		v.Set(reflect.ValueOf(string(content)))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			d.saveError(&UnmarshalTypeError{Value: valueName, Type: v.Type(), Offset: int64(start)})
+			break
+		}
+		b := make([]byte, len(content))
+		copy(b, content)
+		v.SetBytes(b)
+	case reflect.Array:
+		// Fixed size byte arrays like [20]byte hashes must match exactly
+		if v.Type().Elem().Kind() != reflect.Uint8 || v.Len() != len(content) {
+			d.saveError(&UnmarshalTypeError{Value: valueName, Type: v.Type(), Offset: int64(start)})
+			break
+		}
+		reflect.Copy(v, reflect.ValueOf(content))
+	}
+	return nil
+}
+
+// valueInterface is like value but returns interface{}
+func (d *decodeState) valueInterface() (val interface{}) {
+	switch d.opcode {
+	default:
+		panic(phasePanicMsg)
+	case scanBeginList:
+		val = d.listInterface()
+		d.scanNext()
+	case scanBeginDict:
+		val = d.dictInterface()
+		d.scanNext()
+	case scanBeginInt, scanBeginBytes:
+		val = d.literalInterface()
+	}
+	return
+}
+
+// listInterface is like list but returns []interface{}
+func (d *decodeState) listInterface() []interface{} {
+	v := make([]interface{}, 0)
+	d.scanNext()
+	for d.opcode != scanEndList {
+		v = append(v, d.valueInterface())
+	}
+	return v
+}
+
+// dictInterface is like dict but returns map[string]interface{}
+func (d *decodeState) dictInterface() map[string]interface{} {
+	m := make(map[string]interface{})
+	d.scanNext()
+	for d.opcode != scanEndDict {
+		if d.opcode != scanBeginBytes {
+			panic(phasePanicMsg)
+		}
+		start := d.readIndex()
+		d.rescanLiteral()
+		key := string(bytesContent(d.data[start:d.readIndex()]))
+		m[key] = d.valueInterface()
+	}
+	return m
+}
+
+// literalInterface consumes a literal and returns it as int64, *big.Int or string
+func (d *decodeState) literalInterface() interface{} {
+	start := d.readIndex()
+	d.rescanLiteral()
+	item := d.data[start:d.readIndex()]
+	if item[0] != 'i' {
+		return string(bytesContent(item))
+	}
+	return convertInt(string(item[1 : len(item)-1]))
+}
+
+// convertInt returns the digits as int64, or as *big.Int when they don't fit
+func convertInt(s string) interface{} {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err == nil {
+		return n
+	}
+	bi, _ := new(big.Int).SetString(s, 10)
+	return bi
+}
+
+// rescanLiteral is similar to scanWhile(scanContinue), but it specialises the
+// common case where we're decoding a literal. The decoder scans the input
+// twice, once for syntax errors and to check the length of the value, and the
+// second to perform the decoding, so the literal is known to be valid here.
+func (d *decodeState) rescanLiteral() {
+	data, i := d.data, d.off
+	if data[i-1] == 'i' {
+		for data[i] != 'e' {
+			i++
+		}
+		i++
+	} else {
+		n := int(data[i-1] - '0')
+		for data[i] != ':' {
+			n = n*10 + int(data[i]-'0')
+			i++
+		}
+		i += 1 + n
+	}
+	d.scan.endValue()
+	if i < len(d.data) {
+		d.opcode = d.scan.step(&d.scan, data[i])
+	} else {
+		d.opcode = d.scan.eof()
+	}
+	d.off = i + 1
+}
+
 // scanNext process the byte at d.data[d.off]
 func (d *decodeState) scanNext() {
 	if d.off < len(d.data) {
@@ -267,38 +608,74 @@ func (d *decodeState) skip() {
 	}
 }
 
+// addErrorContext fills in where in the input and in the Go value an
+// UnmarshalTypeError occurred
 func (d *decodeState) addErrorContext(err error) error {
+	ute, ok := err.(*UnmarshalTypeError)
+	if !ok {
+		return err
+	}
+	ute.Offset += d.base
+	ute.Path = formatPath(d.path)
 	if d.errorContext.Struct != nil || d.errorContext.Field != "" {
-		switch err := err.(type) {
-		case *UnmarshalTypeError:
-			err.Struct = d.errorContext.Struct.Name()
-			err.Field = d.errorContext.Field
-			return err
-		}
+		ute.Struct = d.errorContext.Struct.Name()
+		ute.Field = d.errorContext.Field
 	}
-	return err
+	return ute
 }
 
-func (d *decodeState) scanWhile(op int) {
-	s, data, i := &d.scan, d.data, d.off
-	for i < len(data) {
-		newOp := s.step(s, data[i])
-		i++
-		if newOp != op {
-			d.opcode = newOp
-			d.off = i
-			return
-		}
+// unmarshalerError puts an error returned by the Unmarshaler of the value at
+// offset start in the context of the whole input. Errors from a nested
+// Unmarshal are relative to the value, so their offset and path are extended.
+func (d *decodeState) unmarshalerError(err error, start int) error {
+	var (
+		ute *UnmarshalTypeError
+		se  *SyntaxError
+		le  *LimitError
+	)
+	off := d.base + int64(start)
+	switch {
+	case errors.As(err, &ute):
+		ute.Offset += off
+		ute.Path = joinPath(formatPath(d.path), ute.Path)
+	case errors.As(err, &se):
+		se.Offset += off
+		se.Path = joinPath(formatPath(d.path), se.Path)
+	case errors.As(err, &le):
+		le.Offset += off
+		le.Path = joinPath(formatPath(d.path), le.Path)
 	}
-
-	d.off = len(data) + 1
-	d.opcode = d.scan.eof()
+	return err
 }
 
-// Unmarshal unmarshal
+// Unmarshal parses the BENCODE-encoded data and stores the result in the
+// value pointed to by v.
 func Unmarshal(data []byte, v interface{}) error {
-	// Check for well-formedness, how?
+	return unmarshal(data, v, false)
+}
+
+// UnmarshalStrict is like Unmarshal but only accepts the canonical encoding
+// described in BEP 3: dictionary keys unique and sorted, no leading zeros in
+// integers or byte string lengths, and no negative zero. Input accepted by
+// UnmarshalStrict encodes back to exactly the same bytes, so a hash over it,
+// like the infohash, is stable.
+func UnmarshalStrict(data []byte, v interface{}) error {
+	return unmarshal(data, v, true)
+}
+
+func unmarshal(data []byte, v interface{}, strict bool) error {
+	// Check for well-formedness first, so that a syntax error halfway
+	// through doesn't leave v half filled.
 	var d decodeState
+	d.scan.strict = strict
+	err := checkValid(data, &d.scan)
+	if err != nil {
+		return addErrorPath(err, data, 0)
+	}
+
+	// The decoder skips over literals without feeding them to the scanner,
+	// which the strict key checks depend on, and the data is valid anyway
+	d.scan.strict = false
 	d.init(data)
 	return d.unmarshal(v)
 }
@@ -307,11 +684,17 @@ func Unmarshal(data []byte, v interface{}) error {
 type UnmarshalTypeError struct {
 	Value  string       // description of value
 	Type   reflect.Type // type of Go value it could not be assigned to
-	Offset int64
-	Struct string // name of the struct type containing the field
-	Field  string // name of the field holding the Go value
+	Offset int64        // offset of the start of the value in the input
+	Struct string       // name of the struct type containing the field
+	Field  string       // name of the field holding the Go value
+	Path   string       // path to the value, like info.files[12].path[3]
 }
 
 func (e *UnmarshalTypeError) Error() string {
-	return "bencode: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
+	if e.Struct != "" || e.Field != "" {
+		return "bencode: cannot unmarshal " + e.Value + " into Go struct field " + e.Struct + "." + e.Field +
+			" of type " + e.Type.String() + errorLocation(e.Path, e.Offset)
+	}
+	return "bencode: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String() +
+		errorLocation(e.Path, e.Offset)
 }
@@ -0,0 +1,354 @@
+package bencode
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type decodeTestFile struct {
+	Length int64    `bencode:"length"`
+	Path   []string `bencode:"path"`
+}
+
+type decodeTestInfo struct {
+	Name        string           `bencode:"name"`
+	PieceLength int64            `bencode:"piece length"`
+	Pieces      []byte           `bencode:"pieces"`
+	Length      int64            `bencode:"length"`
+	Files       []decodeTestFile `bencode:"files"`
+}
+
+type decodeTestMetaInfo struct {
+	Announce string         `bencode:"announce"`
+	Info     decodeTestInfo `bencode:"info"`
+}
+
+var unmarshalTests = []struct {
+	in  string
+	ptr interface{}
+	out interface{}
+}{
+	{"i42e", new(int), 42},
+	{"i-42e", new(int64), int64(-42)},
+	{"i7e", new(uint16), uint16(7)},
+	{"i1e", new(bool), true},
+	{"i0e", new(bool), false},
+	{"5:hello", new(string), "hello"},
+	{"0:", new(string), ""},
+	{"5:hello", new([]byte), []byte("hello")},
+	{"3:abc", new([3]byte), [3]byte{'a', 'b', 'c'}},
+	{"li1ei2ei3ee", new([]int), []int{1, 2, 3}},
+	{"le", new([]int), []int{}},
+	{"l1:a1:be", new([]string), []string{"a", "b"}},
+	{"d1:ai1e1:bi2ee", new(map[string]int), map[string]int{"a": 1, "b": 2}},
+	{"i42e", new(interface{}), int64(42)},
+	{"3:abc", new(interface{}), "abc"},
+	{
+		"d1:ali1e1:xe1:bdee",
+		new(interface{}),
+		map[string]interface{}{"a": []interface{}{int64(1), "x"}, "b": map[string]interface{}{}},
+	},
+	{
+		"d6:lengthi10e4:pathl1:a1:bee",
+		new(decodeTestFile),
+		decodeTestFile{Length: 10, Path: []string{"a", "b"}},
+	},
+	{
+		// Unknown keys are skipped
+		"d5:extrald1:xi1eee6:lengthi3ee",
+		new(decodeTestFile),
+		decodeTestFile{Length: 3},
+	},
+}
+
+func TestUnmarshal(t *testing.T) {
+	for i, tt := range unmarshalTests {
+		v := reflect.New(reflect.TypeOf(tt.ptr).Elem())
+		if err := Unmarshal([]byte(tt.in), v.Interface()); err != nil {
+			t.Errorf("#%d: Unmarshal(%q): %v", i, tt.in, err)
+			continue
+		}
+		if got := v.Elem().Interface(); !reflect.DeepEqual(got, tt.out) {
+			t.Errorf("#%d: Unmarshal(%q) = %#v, want %#v", i, tt.in, got, tt.out)
+		}
+	}
+}
+
+var syntaxErrorTests = []struct {
+	in     string
+	offset int64
+}{
+	{"", 0},
+	{"i12", 3},
+	{"ie", 2},
+	{"i1xe", 3},
+	{"5:abc", 5},
+	{"l", 1},
+	{"di1ei2ee", 2},
+	{"d1:ae", 5},
+	{"x", 1},
+	{"i1ei2e", 4},
+}
+
+func TestUnmarshalSyntaxError(t *testing.T) {
+	for _, tt := range syntaxErrorTests {
+		var v interface{}
+		err := Unmarshal([]byte(tt.in), &v)
+		se, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("Unmarshal(%q): got %v, want *SyntaxError", tt.in, err)
+			continue
+		}
+		if se.Offset != tt.offset {
+			t.Errorf("Unmarshal(%q): offset %d, want %d", tt.in, se.Offset, tt.offset)
+		}
+	}
+}
+
+func TestUnmarshalTypeError(t *testing.T) {
+	var f decodeTestFile
+	err := Unmarshal([]byte("d6:length3:abc4:pathl1:aee"), &f)
+	ute, ok := err.(*UnmarshalTypeError)
+	if !ok {
+		t.Fatalf("got %v, want *UnmarshalTypeError", err)
+	}
+	if ute.Field != "length" || ute.Struct != "decodeTestFile" {
+		t.Errorf("got field %s.%s", ute.Struct, ute.Field)
+	}
+	// Decoding continues past the bad field
+	if !reflect.DeepEqual(f.Path, []string{"a"}) {
+		t.Errorf("got path %q", f.Path)
+	}
+}
+
+func TestUnmarshalTypeErrorPath(t *testing.T) {
+	in := "d8:announce3:url4:infod5:filesld6:lengthi1e4:pathl1:aeed6:lengthi2e4:pathl1:bi3eeee4:name1:xee"
+	var mi decodeTestMetaInfo
+	err := Unmarshal([]byte(in), &mi)
+	var ute *UnmarshalTypeError
+	if !errors.As(fmt.Errorf("loading torrent: %w", err), &ute) {
+		t.Fatalf("got %v, want *UnmarshalTypeError", err)
+	}
+	if ute.Path != "info.files[1].path[1]" {
+		t.Errorf("got path %q", ute.Path)
+	}
+	if want := int64(strings.Index(in, "i3e")); ute.Offset != want {
+		t.Errorf("got offset %d, want %d", ute.Offset, want)
+	}
+	if want := fmt.Sprintf(" at info.files[1].path[1] (offset %d)", ute.Offset); !strings.HasSuffix(ute.Error(), want) {
+		t.Errorf("got message %q", ute.Error())
+	}
+}
+
+func TestSyntaxErrorPath(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		path string
+	}{
+		{"x", ""},
+		{"li1ex", "[1]"},
+		{"d4:infod5:filesld4:pathl1:ai1xeeeee", "info.files[0].path[1]"},
+		{"d4:infod5:filesleie", "info"},
+		{"d1:ai1ei2ee", ""},
+		{"d1:ad3:a.bi-ee", `a["a.b"]`},
+		{"d1:ad2:\xff\xfei-ee", `a["\xff\xfe"]`},
+	} {
+		var v interface{}
+		err := Unmarshal([]byte(tt.in), &v)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("Unmarshal(%q): got %v, want *SyntaxError", tt.in, err)
+			continue
+		}
+		if se.Path != tt.path {
+			t.Errorf("Unmarshal(%q): got path %q, want %q", tt.in, se.Path, tt.path)
+		}
+	}
+
+	err := UnmarshalStrict([]byte("d4:infod1:bi1e1:ai2eee"), new(interface{}))
+	if se, ok := err.(*SyntaxError); !ok || se.Path != "info.a" {
+		t.Errorf("got %#v, want *SyntaxError at info.a", err)
+	}
+}
+
+type pathTestNested struct {
+	Port int `bencode:"port"`
+}
+
+type pathTestUnmarshaler struct {
+	Inner pathTestNested
+}
+
+func (u *pathTestUnmarshaler) UnmarshalBENCODE(b []byte) error {
+	return Unmarshal(b, &u.Inner)
+}
+
+func TestUnmarshalerErrorPath(t *testing.T) {
+	var v struct {
+		Peers []pathTestUnmarshaler `bencode:"peers"`
+	}
+	err := Unmarshal([]byte("d5:peersld4:porti1eed4:port1:xeee"), &v)
+	ute, ok := err.(*UnmarshalTypeError)
+	if !ok {
+		t.Fatalf("got %v, want *UnmarshalTypeError", err)
+	}
+	if ute.Path != "peers[1].port" || ute.Offset != 27 {
+		t.Errorf("got %s at offset %d", ute.Path, ute.Offset)
+	}
+}
+
+func TestUnmarshalTorrentFiles(t *testing.T) {
+	for _, name := range []string{
+		"../../test/data/bootstrap.dat.torrent",
+		"../../test/data/debian-9.1.0-amd64-netinst.iso.torrent",
+	} {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var mi decodeTestMetaInfo
+		if err := Unmarshal(data, &mi); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if mi.Announce == "" || mi.Info.Name == "" || mi.Info.PieceLength == 0 {
+			t.Errorf("%s: missing fields in %+v", name, mi)
+		}
+		if len(mi.Info.Pieces) == 0 || len(mi.Info.Pieces)%20 != 0 {
+			t.Errorf("%s: bad pieces length %d", name, len(mi.Info.Pieces))
+		}
+
+		var v interface{}
+		if err := Unmarshal(data, &v); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, ok := v.(map[string]interface{})["info"]; !ok {
+			t.Errorf("%s: no info dictionary in %v", name, v)
+		}
+	}
+}
+
+func TestUnmarshalStrict(t *testing.T) {
+	for _, tt := range []struct {
+		in string
+		ok bool
+	}{
+		{"i0e", true},
+		{"i-1e", true},
+		{"i10e", true},
+		{"0:", true},
+		{"d1:ai1e1:bi2ee", true},
+		{"d0:i1e1:ai2ee", true},
+		{"dd1:ai1eei2ee", false}, // keys must be strings in any mode
+		{"i-0e", false},
+		{"i03e", false},
+		{"i-03e", false},
+		{"03:abc", false},
+		{"00:", false},
+		{"d1:bi1e1:ai2ee", false},
+		{"d1:ai1e1:ai2ee", false},
+		{"d2:abi1e1:ai2ee", false},
+		// Ordering is only checked among keys of the same dictionary
+		{"d1:bd1:ai1e1:bi2ee1:cd1:ai1eee", true},
+		{"d1:bd1:bi1e1:ai2eee", false},
+	} {
+		var v interface{}
+		err := UnmarshalStrict([]byte(tt.in), &v)
+		if tt.ok && err != nil {
+			t.Errorf("UnmarshalStrict(%q): %v", tt.in, err)
+		}
+		if !tt.ok {
+			if _, isSyntax := err.(*SyntaxError); !isSyntax {
+				t.Errorf("UnmarshalStrict(%q): got %v, want *SyntaxError", tt.in, err)
+			}
+			// The lenient decoder still accepts all the non-canonical forms
+			if err := Unmarshal([]byte(tt.in), &v); err != nil && tt.in != "dd1:ai1eei2ee" {
+				t.Errorf("Unmarshal(%q): %v", tt.in, err)
+			}
+		}
+	}
+}
+
+func TestUnmarshalStrictTorrentFiles(t *testing.T) {
+	for _, name := range []string{
+		"../../test/data/bootstrap.dat.torrent",
+		"../../test/data/debian-9.1.0-amd64-netinst.iso.torrent",
+	} {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v interface{}
+		if err := UnmarshalStrict(data, &v); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestUnmarshalIntOverflow(t *testing.T) {
+	for _, tt := range []struct {
+		in  string
+		ptr interface{}
+	}{
+		{"i128e", new(int8)},
+		{"i-129e", new(int8)},
+		{"i2147483648e", new(int32)},
+		{"i99999999999999999999e", new(int32)},
+		{"i99999999999999999999e", new(int64)},
+		{"i256e", new(uint8)},
+		{"i-1e", new(uint)},
+		{"i18446744073709551616e", new(uint64)},
+	} {
+		err := Unmarshal([]byte(tt.in), tt.ptr)
+		if _, ok := err.(*UnmarshalTypeError); !ok {
+			t.Errorf("Unmarshal(%q) into %T: got %v, want *UnmarshalTypeError", tt.in, tt.ptr, err)
+		}
+	}
+
+	var resp struct {
+		Interval int32 `bencode:"interval"`
+	}
+	err := Unmarshal([]byte("d8:intervali99999999999999999999ee"), &resp)
+	if ute, ok := err.(*UnmarshalTypeError); !ok || ute.Field != "interval" {
+		t.Errorf("got %v, want *UnmarshalTypeError for field interval", err)
+	}
+}
+
+func TestUnmarshalBigInt(t *testing.T) {
+	const huge = "-123456789012345678901234567890"
+	var bi big.Int
+	if err := Unmarshal([]byte("i"+huge+"e"), &bi); err != nil {
+		t.Fatal(err)
+	}
+	if bi.String() != huge {
+		t.Errorf("got %s", &bi)
+	}
+
+	var s struct {
+		N *big.Int `bencode:"n"`
+	}
+	if err := Unmarshal([]byte("d1:ni42ee"), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.N == nil || s.N.Int64() != 42 {
+		t.Errorf("got %v", s.N)
+	}
+
+	// interface{} keeps int64 when it fits and switches to *big.Int otherwise
+	var v interface{}
+	if err := Unmarshal([]byte("li9223372036854775807ei9223372036854775808ee"), &v); err != nil {
+		t.Fatal(err)
+	}
+	l := v.([]interface{})
+	if l[0] != int64(math.MaxInt64) {
+		t.Errorf("got %#v, want int64", l[0])
+	}
+	if b, ok := l[1].(*big.Int); !ok || b.String() != "9223372036854775808" {
+		t.Errorf("got %#v, want *big.Int", l[1])
+	}
+}
@@ -3,6 +3,7 @@ package bencode
 import (
 	"bytes"
 	"encoding"
+	"math/big"
 	"reflect"
 	"sort"
 	"strconv"
@@ -18,7 +19,8 @@ func (e *UnsupportedTypeError) Error() string {
 	return "bencode: unsupported type: " + e.Type.String()
 }
 
-// Marshaler marshaler interface
+// Marshaler is the interface implemented by types that can marshal themselves
+// into valid BENCODE.
 type Marshaler interface {
 	MarshalBENCODE() ([]byte, error)
 }
@@ -132,31 +134,34 @@ func typeEncoder(t reflect.Type) encoderFunc {
 var (
 	marshalerType     = reflect.TypeOf((*Marshaler)(nil)).Elem()
 	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	bigIntType        = reflect.TypeOf(big.Int{})
 )
 
 // newTypeEncoder constructs an encoderFunc for a type.
 // The returned encoder only checks CanAddr when allowAddr is true.
 func newTypeEncoder(t reflect.Type, allowAddr bool) encoderFunc {
-	// Not sure if the following code is necessary
-	/*
-		if t.Implements(marshalerType) {
-			return marshalerEncoder
-		}
-		if t.Kind() != reflect.Ptr && allowAddr {
-			if reflect.PtrTo(t).Implements(marshalerType) {
-				return newCondAddrEncoder(addrMarshalerEncoder, newTypeEncoder(t, false))
-			}
-		}
+	// big.Int is a TextMarshaler, but must be encoded as an integer
+	if t == bigIntType || t == reflect.PtrTo(bigIntType) {
+		return bigIntEncoder
+	}
 
-		if t.Implements(textMarshalerType) {
-			return textMarshalerEncoder
+	if t.Implements(marshalerType) {
+		return marshalerEncoder
+	}
+	if t.Kind() != reflect.Ptr && allowAddr {
+		if reflect.PtrTo(t).Implements(marshalerType) {
+			return newCondAddrEncoder(addrMarshalerEncoder, newTypeEncoder(t, false))
 		}
-		if t.Kind() != reflect.Ptr && allowAddr {
-			if reflect.PtrTo(t).Implements(textMarshalerType) {
-				return newCondAddrEncoder(addrTextMarshalerEncoder, newTypeEncoder(t, false))
-			}
+	}
+
+	if t.Implements(textMarshalerType) {
+		return textMarshalerEncoder
+	}
+	if t.Kind() != reflect.Ptr && allowAddr {
+		if reflect.PtrTo(t).Implements(textMarshalerType) {
+			return newCondAddrEncoder(addrTextMarshalerEncoder, newTypeEncoder(t, false))
 		}
-	*/
+	}
 
 	switch t.Kind() {
 	case reflect.Bool:
@@ -192,22 +197,79 @@ func newTypeEncoder(t reflect.Type, allowAddr bool) encoderFunc {
 
 func marshalerEncoder(e *encodeState, v reflect.Value) {
 	if v.Kind() == reflect.Ptr && v.IsNil() {
-		e.WriteString("null")
+		ptrEncoder(e, v)
 		return
 	}
 	m, ok := v.Interface().(Marshaler)
 	if !ok {
-		e.WriteString("null")
+		e.error(&UnsupportedTypeError{v.Type()})
+	}
+	writeMarshaled(e, v, m)
+}
+
+func addrMarshalerEncoder(e *encodeState, v reflect.Value) {
+	writeMarshaled(e, v, v.Addr().Interface().(Marshaler))
+}
+
+// writeMarshaled copies the output of m into the buffer, checking that it
+// is exactly one well-formed value so a Marshaler can't corrupt the stream
+func writeMarshaled(e *encodeState, v reflect.Value, m Marshaler) {
+	b, err := m.MarshalBENCODE()
+	if err == nil {
+		var scan scanner
+		err = checkValid(b, &scan)
+	}
+	if err != nil {
+		e.error(&MarshalerError{v.Type(), err})
+	}
+	e.Write(b)
+}
+
+func textMarshalerEncoder(e *encodeState, v reflect.Value) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		ptrEncoder(e, v)
 		return
 	}
-	_, err := m.MarshalBENCODE()
-	//if err == nil {
-	// copy BENCODE into buffer, checking validity.
-	// err = compact(&e.Buffer, b)
-	//}
+	m, ok := v.Interface().(encoding.TextMarshaler)
+	if !ok {
+		e.error(&UnsupportedTypeError{v.Type()})
+	}
+	writeTextMarshaled(e, v, m)
+}
+
+func addrTextMarshalerEncoder(e *encodeState, v reflect.Value) {
+	writeTextMarshaled(e, v, v.Addr().Interface().(encoding.TextMarshaler))
+}
+
+// writeTextMarshaled writes the text form of m as a byte string
+func writeTextMarshaled(e *encodeState, v reflect.Value, m encoding.TextMarshaler) {
+	s, err := m.MarshalText()
 	if err != nil {
 		e.error(&MarshalerError{v.Type(), err})
 	}
+	b := strconv.AppendInt(e.scratch[:0], int64(len(s)), 10)
+	e.Write(b)
+	e.WriteString(":")
+	e.Write(s)
+}
+
+type condAddrEncoder struct {
+	canAddrEnc, elseEnc encoderFunc
+}
+
+func (ce condAddrEncoder) encode(e *encodeState, v reflect.Value) {
+	if v.CanAddr() {
+		ce.canAddrEnc(e, v)
+	} else {
+		ce.elseEnc(e, v)
+	}
+}
+
+// newCondAddrEncoder returns an encoder that checks whether its value
+// CanAddr and delegates to canAddrEnc if so, else to elseEnc.
+func newCondAddrEncoder(canAddrEnc, elseEnc encoderFunc) encoderFunc {
+	enc := condAddrEncoder{canAddrEnc: canAddrEnc, elseEnc: elseEnc}
+	return enc.encode
 }
 
 func boolEncoder(e *encodeState, v reflect.Value) {
@@ -232,6 +294,24 @@ func uintEncoder(e *encodeState, v reflect.Value) {
 	e.WriteString("e")
 }
 
+func bigIntEncoder(e *encodeState, v reflect.Value) {
+	var i *big.Int
+	switch {
+	case v.Kind() == reflect.Ptr && v.IsNil():
+		i = new(big.Int)
+	case v.Kind() == reflect.Ptr:
+		i = v.Interface().(*big.Int)
+	case v.CanAddr():
+		i = v.Addr().Interface().(*big.Int)
+	default:
+		c := v.Interface().(big.Int)
+		i = &c
+	}
+	e.WriteString("i")
+	e.Write(i.Append(e.scratch[:0], 10))
+	e.WriteString("e")
+}
+
 func stringEncoder(e *encodeState, v reflect.Value) {
 	s := v.String()
 	b := strconv.AppendInt(e.scratch[:0], int64(len(s)), 10)
@@ -244,8 +324,8 @@ func stringEncoder(e *encodeState, v reflect.Value) {
 func structEncoder(e *encodeState, v reflect.Value) {
 	e.WriteString("d")
 	for _, ef := range encodeFields(v.Type()) {
-		fieldValue := v.Field(ef.i)
-		if ef.omitEmpty && isEmptyValue(fieldValue) {
+		fieldValue, ok := fieldByIndex(v, ef.index)
+		if !ok || ef.omitEmpty && isEmptyValue(fieldValue) {
 			continue
 		}
 		b := strconv.AppendInt(e.scratch[:0], int64(len(ef.tag)), 10)
@@ -257,6 +337,21 @@ func structEncoder(e *encodeState, v reflect.Value) {
 	e.WriteString("e")
 }
 
+// fieldByIndex is like v.FieldByIndex, but reports false instead of
+// panicking when it meets a nil pointer to an inlined struct
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
 func interfaceEncoder(e *encodeState, v reflect.Value) {
 	e.reflectValue(v.Elem())
 }
@@ -270,8 +365,7 @@ func (sv stringValues) get(i int) string   { return sv[i].String() }
 
 func mapEncoder(e *encodeState, v reflect.Value) {
 	if v.Type().Key().Kind() != reflect.String {
-		// panic(&MarshalerError{v.Type()})
-		panic(&UnsupportedTypeError{v.Type()})
+		e.error(&UnsupportedTypeError{v.Type()})
 	}
 	if v.IsNil() {
 		e.WriteString("de")
@@ -292,6 +386,17 @@ func mapEncoder(e *encodeState, v reflect.Value) {
 }
 
 func arrayEncoder(e *encodeState, v reflect.Value) {
+	// Fixed size byte arrays like [20]byte hashes are byte strings, the same
+	// as the decoder expects them
+	if v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8 {
+		b := strconv.AppendInt(e.scratch[:0], int64(v.Len()), 10)
+		e.Write(b)
+		e.WriteString(":")
+		for i, n := 0, v.Len(); i < n; i++ {
+			e.WriteByte(byte(v.Index(i).Uint()))
+		}
+		return
+	}
 	e.WriteString("l")
 	for i, n := 0, v.Len(); i < n; i++ {
 		e.reflectValue(v.Index(i))
@@ -311,7 +416,9 @@ func sliceEncoder(e *encodeState, v reflect.Value) {
 		e.Write(b)
 		e.WriteString(":")
 		e.Write(s)
+		return
 	}
+	arrayEncoder(e, v)
 }
 
 func ptrEncoder(e *encodeState, v reflect.Value) {
@@ -346,9 +453,14 @@ func isEmptyValue(v reflect.Value) bool {
 }
 
 type encodeField struct {
-	i         int
+	index     []int // path to the field, longer than one for inlined structs
 	tag       string
 	omitEmpty bool
+	tagged    bool // the key comes from the tag, which wins over a field name
+
+	// ignoreUnmarshalTypeError leaves the field alone when the value doesn't
+	// fit its type, instead of failing the whole Unmarshal
+	ignoreUnmarshalTypeError bool
 }
 
 var (
@@ -358,11 +470,21 @@ var (
 
 type encodeFieldsSortType []encodeField
 
-func (ef encodeFieldsSortType) Len() int           { return len(ef) }
-func (ef encodeFieldsSortType) Swap(i, j int)      { ef[i], ef[j] = ef[j], ef[i] }
-func (ef encodeFieldsSortType) Less(i, j int) bool { return ef[i].tag < ef[j].tag }
+func (ef encodeFieldsSortType) Len() int      { return len(ef) }
+func (ef encodeFieldsSortType) Swap(i, j int) { ef[i], ef[j] = ef[j], ef[i] }
+func (ef encodeFieldsSortType) Less(i, j int) bool {
+	if ef[i].tag != ef[j].tag {
+		return ef[i].tag < ef[j].tag
+	}
+	// For the same key, shallower fields first, then tagged ones
+	if len(ef[i].index) != len(ef[j].index) {
+		return len(ef[i].index) < len(ef[j].index)
+	}
+	return ef[i].tagged && !ef[j].tagged
+}
 
-// Why use lock?
+// encodeFields returns the fields of a struct type sorted by key, which is
+// the order bencode dictionaries are written in
 func encodeFields(t reflect.Type) []encodeField {
 	typeCacheLock.RLock()
 	fs, ok := encodeFieldsCache[t]
@@ -371,38 +493,79 @@ func encodeFields(t reflect.Type) []encodeField {
 		return fs
 	}
 
-	// Double locking ?
+	fs = typeFields(t)
 	typeCacheLock.Lock()
-	defer typeCacheLock.Unlock()
-	fs, ok = encodeFieldsCache[t]
-	if ok {
-		return fs
-	}
+	encodeFieldsCache[t] = fs
+	typeCacheLock.Unlock()
+	return fs
+}
 
-	for i, n := 0, t.NumField(); i < n; i++ {
-		f := t.Field(i)
-		if f.PkgPath != "" {
-			continue
-		}
-		if f.Anonymous {
-			continue
-		}
-		var ef encodeField
-		ef.i = i
-		ef.tag = f.Name
+// typeFields collects the fields of t, descending into embedded structs and
+// fields tagged inline. As in encoding/json, when several fields have the
+// same key the shallowest one wins, then a tagged one, and if that still
+// leaves a tie none of them is used.
+func typeFields(t reflect.Type) []encodeField {
+	var fs []encodeField
+	onPath := map[reflect.Type]bool{t: true}
+
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i, n := 0, t.NumField(); i < n; i++ {
+			f := t.Field(i)
+			tv := getTag(f.Tag)
+			if tv.Ignore() {
+				continue
+			}
 
-		tv := getTag(f.Tag)
-		if tv.Ignore() {
-			continue
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr && ft.Name() == "" {
+				ft = ft.Elem()
+			}
+			inline := ft.Kind() == reflect.Struct && (f.Anonymous && tv.Key() == "" || tv.HasOpt("inline"))
+			if f.PkgPath != "" {
+				// Unexported, only the exported fields of an embedded struct value are reachable
+				if !inline || !f.Anonymous || f.Type.Kind() == reflect.Ptr {
+					continue
+				}
+			}
+
+			fi := append(index[:len(index):len(index)], i)
+			if inline {
+				if !onPath[ft] {
+					onPath[ft] = true
+					walk(ft, fi)
+					delete(onPath, ft)
+				}
+				continue
+			}
+
+			ef := encodeField{
+				index:                    fi,
+				tag:                      f.Name,
+				omitEmpty:                tv.OmitEmpty(),
+				ignoreUnmarshalTypeError: tv.HasOpt("ignore_unmarshal_type_error"),
+			}
+			if tv.Key() != "" {
+				ef.tag = tv.Key()
+				ef.tagged = true
+			}
+			fs = append(fs, ef)
+		}
+	}
+	walk(t, nil)
+	sort.Sort(encodeFieldsSortType(fs))
+
+	// Keep the dominant field of each key
+	out := fs[:0]
+	for i := 0; i < len(fs); {
+		j := i + 1
+		for j < len(fs) && fs[j].tag == fs[i].tag {
+			j++
 		}
-		if tv.Key() != "" {
-			ef.tag = tv.Key()
+		if j-i == 1 || len(fs[i+1].index) > len(fs[i].index) || fs[i].tagged && !fs[i+1].tagged {
+			out = append(out, fs[i])
 		}
-		ef.omitEmpty = tv.OmitEmpty()
-		fs = append(fs, ef)
+		i = j
 	}
-	fss := encodeFieldsSortType(fs)
-	sort.Sort(fss)
-	encodeFieldsCache[t] = fs
-	return fs
+	return out
 }
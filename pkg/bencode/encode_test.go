@@ -0,0 +1,110 @@
+package bencode
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestMarshalBigInt(t *testing.T) {
+	huge, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	type withBig struct {
+		A big.Int  `bencode:"a"`
+		B *big.Int `bencode:"b"`
+		C *big.Int `bencode:"c"`
+	}
+	for _, tt := range []struct {
+		in   interface{}
+		want string
+	}{
+		{huge, "i-123456789012345678901234567890e"},
+		{*huge, "i-123456789012345678901234567890e"},
+		{withBig{A: *big.NewInt(1), B: big.NewInt(2)}, "d1:ai1e1:bi2e1:ci0ee"},
+		{&withBig{A: *big.NewInt(1), B: big.NewInt(2)}, "d1:ai1e1:bi2e1:ci0ee"},
+		{[]interface{}{int64(1), huge}, "li1ei-123456789012345678901234567890ee"},
+	} {
+		b, err := Marshal(tt.in)
+		if err != nil {
+			t.Errorf("Marshal(%v): %v", tt.in, err)
+			continue
+		}
+		if string(b) != tt.want {
+			t.Errorf("Marshal(%v) = %q, want %q", tt.in, b, tt.want)
+		}
+	}
+}
+
+type tagCommon struct {
+	Name    string `bencode:"name"`
+	Private bool   `bencode:"private,omitempty"`
+}
+
+// TagExtra is exported so a pointer to it can be embedded
+type TagExtra struct {
+	Source string `bencode:"source"`
+}
+
+type tagOptions struct {
+	tagCommon
+	*TagExtra
+	Extra2  TagExtra `bencode:"extra,inline"`
+	Length  int64    `bencode:"length,omitempty"`
+	Files   []string `bencode:"files,omitempty"`
+	Skipped string   `bencode:"-"`
+	Dash    string   `bencode:"-,"`
+	Port    int      `bencode:"port,ignore_unmarshal_type_error"`
+	Name    string   `bencode:"name"` // hides tagCommon.Name
+}
+
+func TestMarshalTagOptions(t *testing.T) {
+	for _, tt := range []struct {
+		in   tagOptions
+		want string
+	}{
+		{tagOptions{}, "d1:-0:4:name0:4:porti0ee"},
+		{
+			tagOptions{
+				tagCommon: tagCommon{Name: "hidden", Private: true},
+				TagExtra:  &TagExtra{Source: "pointer"},
+				Length:    3,
+				Files:     []string{"a"},
+				Skipped:   "x",
+				Dash:      "y",
+				Name:      "n",
+			},
+			// The inline field and the embedded pointer tie on "source" and both lose
+			"d1:-1:y5:filesl1:ae6:lengthi3e4:name1:n4:porti0e7:privatei1ee",
+		},
+	} {
+		b, err := Marshal(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("Marshal(%+v) = %q, want %q", tt.in, b, tt.want)
+		}
+	}
+}
+
+func TestUnmarshalTagOptions(t *testing.T) {
+	var v struct {
+		tagCommon
+		*TagExtra `bencode:",inline"`
+		Port      int    `bencode:"port,ignore_unmarshal_type_error"`
+		Peer      string `bencode:"peer"`
+	}
+	in := "d4:name1:n4:peer1:p4:port4:6881" + "7:privatei1e6:source1:se"
+	if err := Unmarshal([]byte(in), &v); err != nil {
+		t.Fatalf("Unmarshal(%q): %v", in, err)
+	}
+	if v.Name != "n" || !v.Private || v.TagExtra == nil || v.Source != "s" || v.Peer != "p" || v.Port != 0 {
+		t.Errorf("got %+v", v)
+	}
+
+	// Without the option the type error is reported
+	var w struct {
+		Port int `bencode:"port"`
+	}
+	if _, ok := Unmarshal([]byte("d4:port4:6881e"), &w).(*UnmarshalTypeError); !ok {
+		t.Error("expected *UnmarshalTypeError")
+	}
+}
@@ -0,0 +1,100 @@
+package bencode
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// addFuzzSeeds seeds the corpus with the torrents in test/data and the
+// syntax error cases
+func addFuzzSeeds(f *testing.F) {
+	names, err := filepath.Glob("../../test/data/*.torrent")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	for _, tt := range syntaxErrorTests {
+		f.Add([]byte(tt.in))
+	}
+	f.Add([]byte(extendedHandshake))
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v interface{}
+		err := Unmarshal(data, &v)
+
+		// The Tokenizer must agree on what is valid
+		tz := NewTokenizer(data)
+		var tokErr error
+		for tokErr == nil {
+			_, tokErr = tz.Next()
+		}
+		if valid := tokErr == io.EOF; valid != (err == nil) {
+			t.Fatalf("Unmarshal: %v, Tokenizer: %v", err, tokErr)
+		}
+		if err != nil {
+			return
+		}
+
+		// Valid input survives a round trip
+		b, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal(%#v): %v", v, err)
+		}
+		var v2 interface{}
+		if err := UnmarshalStrict(b, &v2); err != nil {
+			t.Fatalf("Marshal output %q is not canonical: %v", b, err)
+		}
+		if !reflect.DeepEqual(v, v2) {
+			t.Fatalf("round trip changed %#v into %#v", v, v2)
+		}
+	})
+}
+
+func FuzzDecoderLimits(f *testing.F) {
+	addFuzzSeeds(f)
+	limits := Limits{MaxDepth: 4, MaxStringLength: 64, MaxTotalBytes: 256}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Measure the input with the Tokenizer, which has no limits
+		tz := NewTokenizer(data)
+		maxDepth, maxString := 0, 0
+		var err error
+		for err == nil {
+			var tok Token
+			tok, err = tz.Next()
+			if tz.Depth() > maxDepth {
+				maxDepth = tz.Depth()
+			}
+			if tok.Kind == TokenBytes || tok.Kind == TokenKey {
+				if len(tok.Value) > maxString {
+					maxString = len(tok.Value)
+				}
+			}
+		}
+		if err != io.EOF {
+			return
+		}
+		within := maxDepth <= limits.MaxDepth && int64(maxString) <= limits.MaxStringLength &&
+			int64(len(data)) <= limits.MaxTotalBytes
+
+		dec := NewDecoder(bytes.NewReader(data))
+		dec.SetLimits(limits)
+		var v interface{}
+		err = dec.Decode(&v)
+		if _, isLimit := err.(*LimitError); within && err != nil || !within && !isLimit {
+			t.Fatalf("depth %d, string %d, total %d: got %v", maxDepth, maxString, len(data), err)
+		}
+	})
+}
@@ -0,0 +1,308 @@
+package bencode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+// The JSON form of BENCODE maps dictionaries to objects, lists to arrays,
+// integers to numbers and byte strings to strings. Byte strings that aren't
+// valid UTF-8, like the pieces of a torrent, can't be JSON strings, so they
+// become an object with the single key "$hex" or "$base64":
+//
+//	{"pieces": {"$hex": "4a5f..."}}
+//
+// Dictionary keys can be binary too. They are written as "$hex:4a5f..." or
+// "$base64:Sl8...". To keep both forms unambiguous, a key that really starts
+// with '$' gets a second '$' in front.
+const (
+	jsonHex    = "$hex"
+	jsonBase64 = "$base64"
+)
+
+// JSONOptions controls the output of ToJSON
+type JSONOptions struct {
+	Base64 bool   // render binary strings as base64 instead of hex
+	Indent string // indent nested values with this string, compact if empty
+}
+
+// ToJSON converts each BENCODE value read from r into JSON written to w,
+// one value per line. Binary strings are rendered as hex.
+func ToJSON(r io.Reader, w io.Writer) error {
+	return JSONOptions{}.ToJSON(r, w)
+}
+
+// ToJSON converts each BENCODE value read from r into JSON written to w,
+// one value per line.
+func (o JSONOptions) ToJSON(r io.Reader, w io.Writer) error {
+	dec := NewDecoder(r)
+	var (
+		raw Bytes
+		tz  Tokenizer
+		out []byte
+		buf bytes.Buffer
+	)
+	for dec.More() {
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		tz.Reset(raw)
+		var err error
+		out, err = o.appendJSON(out[:0], &tz)
+		if err != nil {
+			return err
+		}
+		if o.Indent != "" {
+			buf.Reset()
+			if err := json.Indent(&buf, out, "", o.Indent); err != nil {
+				return err
+			}
+			out = append(out[:0], buf.Bytes()...)
+		}
+		out = append(out, '\n')
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendJSON appends the JSON form of the value tz is reading
+func (o JSONOptions) appendJSON(dst []byte, tz *Tokenizer) ([]byte, error) {
+	first := true
+	for {
+		tok, err := tz.Next()
+		if err == io.EOF {
+			return dst, nil
+		}
+		if err != nil {
+			return dst, err
+		}
+
+		// Separators go before anything that isn't closing a container
+		switch tok.Kind {
+		case TokenListEnd, TokenDictEnd:
+		default:
+			if !first {
+				dst = append(dst, ',')
+			}
+		}
+		first = false
+
+		switch tok.Kind {
+		case TokenInt:
+			dst = appendJSONInt(dst, tok.Value)
+		case TokenBytes:
+			dst = o.appendJSONBytes(dst, tok.Value)
+		case TokenKey:
+			dst = o.appendJSONKey(dst, tok.Value)
+			dst = append(dst, ':')
+			// The value follows without a separator
+			first = true
+		case TokenListStart:
+			dst = append(dst, '[')
+			first = true
+		case TokenDictStart:
+			dst = append(dst, '{')
+			first = true
+		case TokenListEnd:
+			dst = append(dst, ']')
+		case TokenDictEnd:
+			dst = append(dst, '}')
+		}
+	}
+}
+
+// appendJSONInt appends the integer v as a JSON number. Outside of strict
+// mode BENCODE allows leading zeros and negative zero, which JSON doesn't.
+func appendJSONInt(dst, v []byte) []byte {
+	digits := v
+	if len(digits) > 0 && digits[0] == '-' {
+		digits = digits[1:]
+	}
+	if len(digits) > 0 && digits[0] != '0' || string(v) == "0" {
+		return append(dst, v...)
+	}
+	n, _ := new(big.Int).SetString(string(v), 10)
+	return n.Append(dst, 10)
+}
+
+func (o JSONOptions) binaryKind() string {
+	if o.Base64 {
+		return jsonBase64
+	}
+	return jsonHex
+}
+
+func (o JSONOptions) encodeBinary(b []byte) string {
+	if o.Base64 {
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	return hex.EncodeToString(b)
+}
+
+func (o JSONOptions) appendJSONBytes(dst []byte, b []byte) []byte {
+	if utf8.Valid(b) {
+		return appendJSONString(dst, string(b))
+	}
+	dst = append(dst, '{')
+	dst = appendJSONString(dst, o.binaryKind())
+	dst = append(dst, ':')
+	dst = appendJSONString(dst, o.encodeBinary(b))
+	return append(dst, '}')
+}
+
+func (o JSONOptions) appendJSONKey(dst []byte, b []byte) []byte {
+	if !utf8.Valid(b) {
+		return appendJSONString(dst, o.binaryKind()+":"+o.encodeBinary(b))
+	}
+	if len(b) > 0 && b[0] == '$' {
+		return appendJSONString(dst, "$"+string(b))
+	}
+	return appendJSONString(dst, string(b))
+}
+
+// appendJSONString appends s as a JSON string, without the HTML escaping
+// json.Marshal does
+func appendJSONString(dst []byte, s string) []byte {
+	const hexDigits = "0123456789abcdef"
+	dst = append(dst, '"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			dst = append(dst, '\\', c)
+		case c == '\n':
+			dst = append(dst, '\\', 'n')
+		case c == '\r':
+			dst = append(dst, '\\', 'r')
+		case c == '\t':
+			dst = append(dst, '\\', 't')
+		case c < 0x20:
+			dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return append(dst, '"')
+}
+
+// FromJSON converts each JSON value read from r, in the form written by
+// ToJSON, into BENCODE written to w. Besides what ToJSON writes, true and
+// false are accepted as 1 and 0. Dictionary keys are sorted, so the output
+// is canonical regardless of the order in the JSON.
+func FromJSON(r io.Reader, w io.Writer) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	enc := NewEncoder(w)
+	for {
+		var v interface{}
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		bv, err := fromJSONValue(v)
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(bv); err != nil {
+			return err
+		}
+	}
+}
+
+// fromJSONValue converts a value decoded by encoding/json into one that
+// Marshal encodes as the intended BENCODE
+func fromJSONValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		n, ok := new(big.Int).SetString(string(v), 10)
+		if !ok {
+			return nil, fmt.Errorf("bencode: JSON number %s is not an integer", v)
+		}
+		return n, nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			var err error
+			if l[i], err = fromJSONValue(e); err != nil {
+				return nil, err
+			}
+		}
+		return l, nil
+	case map[string]interface{}:
+		if len(v) == 1 {
+			for k, e := range v {
+				if k == jsonHex || k == jsonBase64 {
+					s, ok := e.(string)
+					if !ok {
+						return nil, fmt.Errorf("bencode: JSON %s value must be a string", k)
+					}
+					return decodeBinary(k, s)
+				}
+			}
+		}
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			key, err := fromJSONKey(k)
+			if err != nil {
+				return nil, err
+			}
+			if m[key], err = fromJSONValue(e); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case nil:
+		return nil, errors.New("bencode: JSON null has no BENCODE form")
+	}
+	return nil, fmt.Errorf("bencode: unexpected JSON value %T", v)
+}
+
+func fromJSONKey(k string) (string, error) {
+	if !strings.HasPrefix(k, "$") {
+		return k, nil
+	}
+	if strings.HasPrefix(k, "$$") {
+		return k[1:], nil
+	}
+	for _, kind := range []string{jsonHex, jsonBase64} {
+		if strings.HasPrefix(k, kind+":") {
+			b, err := decodeBinary(kind, k[len(kind)+1:])
+			return string(b), err
+		}
+	}
+	return "", fmt.Errorf("bencode: JSON key %q starts with an unescaped '$'", k)
+}
+
+func decodeBinary(kind, s string) ([]byte, error) {
+	var b []byte
+	var err error
+	if kind == jsonHex {
+		b, err = hex.DecodeString(s)
+	} else {
+		b, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bencode: bad JSON %s string: %s", kind, err)
+	}
+	return b, nil
+}
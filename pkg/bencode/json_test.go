@@ -0,0 +1,117 @@
+package bencode
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var jsonTests = []struct {
+	bencode string
+	json    string
+	base64  string
+}{
+	{"i-42e", `-42`, `-42`},
+	{"i123456789012345678901234567890e", `123456789012345678901234567890`, ``},
+	{"5:hello", `"hello"`, ``},
+	{"4:a\"\n\x01", `"a\"\n\u0001"`, ``},
+	{"2:\xff\x00", `{"$hex":"ff00"}`, `{"$base64":"/wA="}`},
+	{"le", `[]`, ``},
+	{"de", `{}`, ``},
+	{"li1e1:ae", `[1,"a"]`, ``},
+	{"d1:ai1e1:bli2eee", `{"a":1,"b":[2]}`, ``},
+	{"d2:\xab\xcdi1ee", `{"$hex:abcd":1}`, `{"$base64:q80=":1}`},
+	{"d4:$hexi1e1:x1:ye", `{"$$hex":1,"x":"y"}`, ``},
+	{"d4:$hex1:ae", `{"$$hex":"a"}`, ``},
+}
+
+func TestToJSON(t *testing.T) {
+	for _, tt := range jsonTests {
+		var out bytes.Buffer
+		if err := ToJSON(strings.NewReader(tt.bencode), &out); err != nil {
+			t.Errorf("ToJSON(%q): %v", tt.bencode, err)
+			continue
+		}
+		if got := strings.TrimSuffix(out.String(), "\n"); got != tt.json {
+			t.Errorf("ToJSON(%q) = %s, want %s", tt.bencode, got, tt.json)
+		}
+		if tt.base64 == "" {
+			continue
+		}
+		out.Reset()
+		if err := (JSONOptions{Base64: true}).ToJSON(strings.NewReader(tt.bencode), &out); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSuffix(out.String(), "\n"); got != tt.base64 {
+			t.Errorf("ToJSON(%q) with base64 = %s, want %s", tt.bencode, got, tt.base64)
+		}
+	}
+}
+
+func TestToJSONNonCanonicalInt(t *testing.T) {
+	for in, want := range map[string]string{
+		"i007e":     `7`,
+		"i-007e":    `-7`,
+		"i-0e":      `0`,
+		"i00e":      `0`,
+		"li0ei01ee": `[0,1]`,
+	} {
+		var out bytes.Buffer
+		if err := ToJSON(strings.NewReader(in), &out); err != nil {
+			t.Errorf("ToJSON(%q): %v", in, err)
+			continue
+		}
+		if got := strings.TrimSuffix(out.String(), "\n"); got != want {
+			t.Errorf("ToJSON(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	for _, tt := range jsonTests {
+		for _, in := range []string{tt.json, tt.base64} {
+			if in == "" {
+				continue
+			}
+			var out bytes.Buffer
+			if err := FromJSON(strings.NewReader(in), &out); err != nil {
+				t.Errorf("FromJSON(%s): %v", in, err)
+				continue
+			}
+			if out.String() != tt.bencode {
+				t.Errorf("FromJSON(%s) = %q, want %q", in, out.String(), tt.bencode)
+			}
+		}
+	}
+
+	for _, in := range []string{`null`, `1.5`, `{"$hex":"xyz"}`, `{"$key":1}`, `{"$hex":1}`} {
+		if err := FromJSON(strings.NewReader(in), ioutil.Discard); err == nil {
+			t.Errorf("FromJSON(%s): expected error", in)
+		}
+	}
+}
+
+func TestJSONRoundTripTorrents(t *testing.T) {
+	names, err := filepath.Glob("../../test/data/*.torrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var j, b bytes.Buffer
+		if err := (JSONOptions{Indent: "  "}).ToJSON(bytes.NewReader(data), &j); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := FromJSON(&j, &b); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(b.Bytes(), data) {
+			t.Errorf("%s: round trip through JSON changed the torrent", name)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package bencode
+
+import (
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// pathElem is one step on the way from the top-level value down to the
+// value an error is about: a list index or a dictionary key.
+type pathElem struct {
+	list  bool
+	index int    // index of the current list element, -1 before the first
+	key   []byte // current dictionary key, nil when none is being read
+}
+
+// formatPath renders a path the way it would be written in jq or
+// JavaScript, like info.files[12].path[3]. Keys that can't be written
+// bare, like binary ones, are quoted: info["a.b"].
+func formatPath(path []pathElem) string {
+	var b []byte
+	for _, e := range path {
+		switch {
+		case e.list && e.index >= 0:
+			b = append(b, '[')
+			b = strconv.AppendInt(b, int64(e.index), 10)
+			b = append(b, ']')
+		case !e.list && e.key != nil:
+			if !plainPathKey(e.key) {
+				b = append(b, '[')
+				b = strconv.AppendQuote(b, string(e.key))
+				b = append(b, ']')
+				break
+			}
+			if len(b) > 0 {
+				b = append(b, '.')
+			}
+			b = append(b, e.key...)
+		}
+	}
+	return string(b)
+}
+
+// joinPath appends the path inner, relative to the value at outer
+func joinPath(outer, inner string) string {
+	switch {
+	case outer == "":
+		return inner
+	case inner == "":
+		return outer
+	case inner[0] == '[':
+		return outer + inner
+	}
+	return outer + "." + inner
+}
+
+// plainPathKey reports whether key can be written in a path without quotes
+func plainPathKey(key []byte) bool {
+	if len(key) == 0 || !utf8.Valid(key) {
+		return false
+	}
+	for _, r := range string(key) {
+		if r == '.' || r == '[' || r == ']' || r == '"' || !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// pathAt returns the path to the byte at data[off-1], where off is an
+// error offset counting the offending byte. It tokenizes the input again,
+// which is fine since it's only done once an error has occurred.
+func pathAt(data []byte, off int64) string {
+	var path []pathElem
+	tz := Tokenizer{noPath: true}
+	tz.Reset(data)
+	for {
+		tok, err := tz.Next()
+		if err != nil {
+			// The offending byte is where the next element of a list was
+			// expected
+			if n := len(path); n > 0 && path[n-1].list {
+				path[n-1].index++
+			}
+			break
+		}
+		if int64(tok.Offset) >= off {
+			break
+		}
+
+		n := len(path)
+		switch tok.Kind {
+		case TokenKey:
+			path[n-1].key = tok.Value
+			continue
+		case TokenListEnd, TokenDictEnd:
+			path = path[:n-1]
+			n--
+			if n > 0 && !path[n-1].list {
+				path[n-1].key = nil
+			}
+			continue
+		}
+
+		// tok starts a value
+		if n > 0 && path[n-1].list {
+			path[n-1].index++
+		}
+		switch tok.Kind {
+		case TokenListStart:
+			path = append(path, pathElem{list: true, index: -1})
+		case TokenDictStart:
+			path = append(path, pathElem{})
+		default:
+			if n > 0 && !path[n-1].list {
+				path[n-1].key = nil
+			}
+		}
+	}
+	return formatPath(path)
+}
+
+// errorLocation describes where an error occurred, for Error methods
+func errorLocation(path string, offset int64) string {
+	if path == "" {
+		return " at offset " + strconv.FormatInt(offset, 10)
+	}
+	return " at " + path + " (offset " + strconv.FormatInt(offset, 10) + ")"
+}
+
+// addErrorPath fills in the path of syntax and limit errors found in data,
+// the value that starts at offset base of the input
+func addErrorPath(err error, data []byte, base int64) error {
+	switch err := err.(type) {
+	case *SyntaxError:
+		err.Path = pathAt(data, err.Offset-base)
+	case *LimitError:
+		err.Path = pathAt(data, err.Offset-base)
+	}
+	return err
+}
@@ -1,58 +1,398 @@
 package bencode
 
+import (
+	"bytes"
+	"strconv"
+)
+
+// The scanner is a byte-at-a-time state machine, like the one in encoding/json.
+// Each call to step reports an opcode describing the byte it was fed.
 const (
-	scanSkipSpace = iota
-	scanBeginList
-	scanBeginDict
-	scanBeginBytes
-	scanBeginNum
-	scanEndList
-	scanError
-	scanListValue
+	scanContinue   = iota // uninteresting byte
+	scanBeginInt          // 'i' starting an integer
+	scanBeginBytes        // first digit of a byte string length
+	scanBeginList         // 'l' starting a list
+	scanBeginDict         // 'd' starting a dictionary
+	scanEndList           // 'e' ending a list
+	scanEndDict           // 'e' ending a dictionary
+
+	// Stop.
+	scanEnd   // top-level value ended before this byte, known at eof
+	scanError // hit an error, scanner.err
 )
 
-// parseState values
+// parseState values, they describe what the enclosing containers expect next
 const (
-	parseList = iota
-	parseDict
-	parseBytes
-	parseNum
+	parseListValue = iota // parsing list elements
+	parseDictKey          // parsing a dictionary key
+	parseDictValue        // parsing a dictionary value
 )
 
 // SyntaxError is a description of a BENCODE syntax error.
 type SyntaxError struct {
 	msg    string
-	Offset int64
+	Offset int64  // error occurred after reading Offset bytes
+	Path   string // path to the offending value, like info.files[12].path[3]
 }
 
 func (e *SyntaxError) Error() string {
-	return e.msg
+	return "bencode: " + e.msg + errorLocation(e.Path, e.Offset)
+}
+
+// DefaultMaxDepth is the nesting depth of lists and dictionaries allowed when
+// Limits.MaxDepth isn't set. The decoder recurses for every level, so even
+// trusted input gets a bound to keep it from exhausting the stack.
+const DefaultMaxDepth = 10000
+
+// Limits bounds the resources used to decode untrusted input, like tracker
+// responses and metadata received from peers. A zero field means no limit,
+// except for MaxDepth which then defaults to DefaultMaxDepth.
+type Limits struct {
+	MaxDepth        int   // nesting of lists and dictionaries
+	MaxStringLength int64 // length of a single byte string
+	MaxTotalBytes   int64 // length of one complete encoded value
+}
+
+// LimitError is returned when the input exceeds one of the Limits.
+type LimitError struct {
+	Limit  string // name of the Limits field that was exceeded
+	Value  int64  // the configured limit
+	Offset int64  // error occurred after reading Offset bytes
+	Path   string // path to the offending value, like info.files[12].path[3]
+}
+
+func (e *LimitError) Error() string {
+	return "bencode: input exceeds " + e.Limit + " of " + strconv.FormatInt(e.Value, 10) +
+		errorLocation(e.Path, e.Offset)
 }
 
 // scanner like the scanner in encoding/json
 type scanner struct {
-	step       func(*scanner, byte) int
+	// step is the function to call for the next byte.
+	step func(*scanner, byte) int
+
+	// endTop is set once the top-level value is complete.
+	endTop bool
+
 	err        error
-	bytes      int64 // total bytes consumed
+	bytes      int64 // total bytes consumed, updated by the caller
 	parseState []int
+
+	// strLen is the declared length of the byte string being parsed,
+	// and then the number of bytes of it still to be read.
+	strLen int64
+
+	// limits bounds the resources hostile input can make the decoder use
+	limits Limits
+
+	// strict rejects input that isn't in the canonical form of BEP 3, so
+	// re-encoding the decoded value gives back the same bytes.
+	strict bool
+	// key is the dictionary key being read, lastKeys holds the previous
+	// key of each dictionary on the stack. Only used in strict mode.
+	key      []byte
+	lastKeys []dictKey
+}
+
+type dictKey struct {
+	key   []byte
+	valid bool // false until the first key of the dictionary is read
 }
 
 func (s *scanner) reset() {
-	s.step = nil
+	s.step = stateBeginValue
+	s.parseState = s.parseState[0:0]
 	s.err = nil
+	s.endTop = false
+	s.strLen = 0
 }
 
+// eof tells the scanner that the end of input has been reached.
 func (s *scanner) eof() int {
 	if s.err != nil {
 		return scanError
 	}
-	s.step(s, ' ')
-	if s.err == nil {
-		s.err = &SyntaxError{"unexpected end of BENCOD input", s.bytes}
+	if s.endTop {
+		return scanEnd
+	}
+	s.err = &SyntaxError{msg: "unexpected end of BENCODE input", Offset: s.bytes}
+	return scanError
+}
+
+// pushParseState enters a container, successState is returned unless the
+// nesting gets too deep.
+func (s *scanner) pushParseState(p int, successState int) int {
+	maxDepth := s.limits.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	if len(s.parseState) >= maxDepth {
+		return s.limitError("MaxDepth", int64(maxDepth))
+	}
+	s.parseState = append(s.parseState, p)
+	if s.strict && p == parseDictKey {
+		n := len(s.parseState)
+		for len(s.lastKeys) < n {
+			s.lastKeys = append(s.lastKeys, dictKey{})
+		}
+		s.lastKeys[n-1].valid = false
+	}
+	return successState
+}
+
+// readingKey reports whether the byte string being parsed is a dictionary key
+func (s *scanner) readingKey() bool {
+	return s.strict && len(s.parseState) > 0 && s.parseState[len(s.parseState)-1] == parseDictKey
+}
+
+// endBytes is called on the last byte of a byte string. In strict mode keys
+// are checked to be unique and sorted as raw strings.
+func (s *scanner) endBytes() int {
+	if s.readingKey() {
+		last := &s.lastKeys[len(s.parseState)-1]
+		if last.valid {
+			switch cmp := bytes.Compare(s.key, last.key); {
+			case cmp == 0:
+				return s.errorMsg("duplicate dictionary key " + strconv.Quote(string(s.key)))
+			case cmp < 0:
+				return s.errorMsg("dictionary key " + strconv.Quote(string(s.key)) + " out of order")
+			}
+		}
+		last.key = append(last.key[:0], s.key...)
+		last.valid = true
+	}
+	s.endValue()
+	return scanContinue
+}
+
+// popParseState pops a container off the stack, the container itself is
+// then a finished value.
+func (s *scanner) popParseState() {
+	s.parseState = s.parseState[0 : len(s.parseState)-1]
+	s.endValue()
+}
+
+// endValue is called on the last byte of a value.
+func (s *scanner) endValue() {
+	if len(s.parseState) == 0 {
+		s.endTop = true
+		s.step = stateEndTop
+		return
+	}
+	s.step = stateEndValue
+}
+
+// stateBeginValue is the state at the beginning of any value.
+func stateBeginValue(s *scanner, c byte) int {
+	switch {
+	case c == 'i':
+		s.step = stateBeginInt
+		return scanBeginInt
+	case c == 'l':
+		s.step = stateBeginValueOrEndList
+		return s.pushParseState(parseListValue, scanBeginList)
+	case c == 'd':
+		s.step = stateBeginKeyOrEndDict
+		return s.pushParseState(parseDictKey, scanBeginDict)
+	case '0' <= c && c <= '9':
+		if s.readingKey() {
+			s.key = s.key[:0]
+		}
+		s.strLen = int64(c - '0')
+		s.step = stateBytesLen
+		if s.limits.MaxStringLength > 0 && s.strLen > s.limits.MaxStringLength {
+			return s.limitError("MaxStringLength", s.limits.MaxStringLength)
+		}
+		return scanBeginBytes
+	}
+	return s.error(c, "looking for beginning of value")
+}
+
+// stateBeginValueOrEndList is the state after reading 'l' or a list element.
+func stateBeginValueOrEndList(s *scanner, c byte) int {
+	if c == 'e' {
+		s.popParseState()
+		return scanEndList
+	}
+	return stateBeginValue(s, c)
+}
+
+// stateBeginKeyOrEndDict is the state after reading 'd' or a dictionary value.
+func stateBeginKeyOrEndDict(s *scanner, c byte) int {
+	if c == 'e' {
+		s.popParseState()
+		return scanEndDict
+	}
+	if '0' <= c && c <= '9' {
+		return stateBeginValue(s, c)
+	}
+	return s.error(c, "looking for beginning of dictionary key")
+}
+
+// stateEndValue is the state after completing a value inside a container.
+func stateEndValue(s *scanner, c byte) int {
+	ps := s.parseState[len(s.parseState)-1]
+	switch ps {
+	case parseDictKey:
+		s.parseState[len(s.parseState)-1] = parseDictValue
+		return stateBeginValue(s, c)
+	case parseDictValue:
+		s.parseState[len(s.parseState)-1] = parseDictKey
+		return stateBeginKeyOrEndDict(s, c)
+	}
+	return stateBeginValueOrEndList(s, c)
+}
+
+// stateEndTop is the state after finishing the top-level value.
+func stateEndTop(s *scanner, c byte) int {
+	return s.error(c, "after top-level value")
+}
+
+// stateBeginInt is the state after reading 'i'.
+func stateBeginInt(s *scanner, c byte) int {
+	if c == '-' {
+		s.step = stateIntNeg
+		return scanContinue
+	}
+	return stateIntDigit(s, c)
+}
+
+// stateIntNeg is the state after reading the '-' of an integer.
+func stateIntNeg(s *scanner, c byte) int {
+	if s.strict && c == '0' {
+		// Covers both i-0e and leading zeros
+		return s.error(c, "in numeric literal after '-'")
+	}
+	return stateIntDigit(s, c)
+}
+
+// stateIntDigit is the state where the first digit of an integer is expected.
+func stateIntDigit(s *scanner, c byte) int {
+	if s.strict && c == '0' {
+		s.step = stateIntZero
+		return scanContinue
+	}
+	if '0' <= c && c <= '9' {
+		s.step = stateInt
+		return scanContinue
+	}
+	return s.error(c, "in numeric literal")
+}
+
+// stateIntZero is the state after a leading '0' of an integer in strict mode.
+func stateIntZero(s *scanner, c byte) int {
+	if c == 'e' {
+		s.endValue()
+		return scanContinue
+	}
+	return s.error(c, "in numeric literal after leading zero")
+}
+
+// stateInt is the state after reading at least one digit of an integer.
+func stateInt(s *scanner, c byte) int {
+	if '0' <= c && c <= '9' {
+		return scanContinue
+	}
+	if c == 'e' {
+		s.endValue()
+		return scanContinue
+	}
+	return s.error(c, "in numeric literal")
+}
+
+// maxStringLength bounds byte string lengths so they can't overflow int.
+const maxStringLength = int64(^uint(0)>>1) / 10
+
+// stateBytesLen is the state while reading the length of a byte string.
+func stateBytesLen(s *scanner, c byte) int {
+	if '0' <= c && c <= '9' {
+		if s.strict && s.strLen == 0 {
+			return s.error(c, "in byte string length after leading zero")
+		}
+		if s.strLen >= maxStringLength {
+			return s.error(c, "in byte string length, length too large")
+		}
+		s.strLen = s.strLen*10 + int64(c-'0')
+		if s.limits.MaxStringLength > 0 && s.strLen > s.limits.MaxStringLength {
+			return s.limitError("MaxStringLength", s.limits.MaxStringLength)
+		}
+		return scanContinue
+	}
+	if c == ':' {
+		if s.strLen == 0 {
+			return s.endBytes()
+		}
+		s.step = stateBytes
+		return scanContinue
+	}
+	return s.error(c, "in byte string length")
+}
+
+// stateBytes is the state while reading the content of a byte string.
+func stateBytes(s *scanner, c byte) int {
+	if s.readingKey() {
+		s.key = append(s.key, c)
+	}
+	s.strLen--
+	if s.strLen == 0 {
+		return s.endBytes()
 	}
+	return scanContinue
+}
+
+// stateError is the state after reaching a syntax error.
+func stateError(s *scanner, c byte) int {
+	return scanError
+}
+
+// error records an error and switches to the error state.
+func (s *scanner) error(c byte, context string) int {
+	s.step = stateError
+	s.err = &SyntaxError{msg: "invalid character " + quoteChar(c) + " " + context, Offset: s.bytes}
 	return scanError
 }
 
+// errorMsg is like error for errors that aren't about a single character.
+func (s *scanner) errorMsg(msg string) int {
+	s.step = stateError
+	s.err = &SyntaxError{msg: msg, Offset: s.bytes}
+	return scanError
+}
+
+// limitError stops the scanner when the input exceeds one of its limits.
+func (s *scanner) limitError(limit string, value int64) int {
+	s.step = stateError
+	s.err = &LimitError{Limit: limit, Value: value, Offset: s.bytes}
+	return scanError
+}
+
+// quoteChar formats c as a quoted character literal
+func quoteChar(c byte) string {
+	if c == '\'' {
+		return `'\''`
+	}
+	if c == '"' {
+		return `'"'`
+	}
+	s := strconv.Quote(string(c))
+	return "'" + s[1:len(s)-1] + "'"
+}
+
+// checkValid verifies that data is valid BENCODE-encoded data.
+// scan is passed in for use by checkValid to avoid an allocation.
 func checkValid(data []byte, scan *scanner) error {
+	scan.reset()
+	if max := scan.limits.MaxTotalBytes; max > 0 && int64(len(data)) > max {
+		return &LimitError{Limit: "MaxTotalBytes", Value: max, Offset: max}
+	}
+	for _, c := range data {
+		scan.bytes++
+		if scan.step(scan, c) == scanError {
+			return scan.err
+		}
+	}
+	if scan.eof() == scanError {
+		return scan.err
+	}
 	return nil
 }
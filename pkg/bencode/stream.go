@@ -0,0 +1,194 @@
+package bencode
+
+import (
+	"bytes"
+	"io"
+)
+
+// Decoder reads and decodes BENCODE values from an input stream.
+type Decoder struct {
+	r       io.Reader
+	buf     []byte
+	d       decodeState
+	scanp   int   // start of unread data in buf
+	scanned int64 // amount of data already scanned
+	scan    scanner
+	err     error
+}
+
+// NewDecoder returns a new decoder that reads from r.
+//
+// The decoder introduces its own buffering and may read data from r
+// beyond the BENCODE values requested.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Decode reads the next BENCODE-encoded value from its input and stores it
+// in the value pointed to by v.
+func (dec *Decoder) Decode(v interface{}) error {
+	if dec.err != nil {
+		return dec.err
+	}
+
+	n, err := dec.readValue()
+	if err != nil {
+		return err
+	}
+	dec.d.init(dec.buf[dec.scanp : dec.scanp+n])
+	dec.d.scan.limits = dec.scan.limits
+	dec.d.base = dec.InputOffset()
+	dec.scanp += n
+
+	// Don't save err from unmarshal into dec.err:
+	// the connection is still usable since we read a complete value.
+	return dec.d.unmarshal(v)
+}
+
+// Strict causes the Decoder to reject input that isn't canonically encoded,
+// see UnmarshalStrict.
+func (dec *Decoder) Strict() {
+	dec.scan.strict = true
+}
+
+// SetLimits bounds the resources used to decode each value, so hostile
+// input can't exhaust memory or stack. Values exceeding them fail with a
+// *LimitError.
+func (dec *Decoder) SetLimits(l Limits) {
+	dec.scan.limits = l
+}
+
+// Buffered returns a reader of the data remaining in the Decoder's buffer.
+// The reader is valid until the next call to Decode.
+func (dec *Decoder) Buffered() io.Reader {
+	return bytes.NewReader(dec.buf[dec.scanp:])
+}
+
+// readValue reads a BENCODE value into dec.buf.
+// It returns the length of the encoding.
+func (dec *Decoder) readValue() (int, error) {
+	dec.scan.reset()
+	dec.scan.bytes = dec.InputOffset()
+
+	scanp := dec.scanp
+	var err error
+Input:
+	// Bencode values are self-delimiting, so the scanner knows the value is
+	// complete on its last byte and we never need to look past it.
+	for {
+		for ; scanp < len(dec.buf); scanp++ {
+			dec.scan.bytes++
+			if dec.scan.step(&dec.scan, dec.buf[scanp]) == scanError {
+				dec.err = addErrorPath(dec.scan.err, dec.buf[dec.scanp:scanp+1], dec.InputOffset())
+				return 0, dec.err
+			}
+			if max := dec.scan.limits.MaxTotalBytes; max > 0 && int64(scanp-dec.scanp) >= max {
+				dec.err = addErrorPath(&LimitError{Limit: "MaxTotalBytes", Value: max, Offset: dec.scan.bytes},
+					dec.buf[dec.scanp:scanp+1], dec.InputOffset())
+				return 0, dec.err
+			}
+			if dec.scan.endTop {
+				scanp++
+				break Input
+			}
+		}
+
+		// Did the last read have an error?
+		// Delayed until now to allow buffer scan.
+		if err != nil {
+			if err == io.EOF && scanp > dec.scanp {
+				err = io.ErrUnexpectedEOF
+			}
+			dec.err = err
+			return 0, err
+		}
+
+		n := scanp - dec.scanp
+		err = dec.refill()
+		scanp = dec.scanp + n
+	}
+	return scanp - dec.scanp, nil
+}
+
+func (dec *Decoder) refill() error {
+	// Make room to read more into the buffer.
+	// First slide down data already consumed.
+	if dec.scanp > 0 {
+		dec.scanned += int64(dec.scanp)
+		n := copy(dec.buf, dec.buf[dec.scanp:])
+		dec.buf = dec.buf[:n]
+		dec.scanp = 0
+	}
+
+	// Grow buffer if not large enough.
+	const minRead = 512
+	if cap(dec.buf)-len(dec.buf) < minRead {
+		newBuf := make([]byte, len(dec.buf), 2*cap(dec.buf)+minRead)
+		copy(newBuf, dec.buf)
+		dec.buf = newBuf
+	}
+
+	// Read. Delay error for next iteration (after scan).
+	n, err := dec.r.Read(dec.buf[len(dec.buf):cap(dec.buf)])
+	dec.buf = dec.buf[0 : len(dec.buf)+n]
+
+	return err
+}
+
+// More reports whether there is another value in the input stream.
+func (dec *Decoder) More() bool {
+	return dec.peek() == nil
+}
+
+// peek makes sure there is at least one unread byte in the buffer.
+func (dec *Decoder) peek() error {
+	var err error
+	for {
+		if dec.scanp < len(dec.buf) {
+			return nil
+		}
+		// buffer has been scanned, now report any error
+		if err != nil {
+			return err
+		}
+		err = dec.refill()
+	}
+}
+
+// InputOffset returns the input stream byte offset of the current decoder
+// position. The offset gives the location of the end of the most recently
+// decoded value and the beginning of the next one.
+func (dec *Decoder) InputOffset() int64 {
+	return dec.scanned + int64(dec.scanp)
+}
+
+// Encoder writes BENCODE values to an output stream.
+type Encoder struct {
+	w   io.Writer
+	err error
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the BENCODE encoding of v to the stream. Unlike JSON, no
+// separator is written: bencoded values are self-delimiting.
+func (enc *Encoder) Encode(v interface{}) error {
+	if enc.err != nil {
+		return enc.err
+	}
+
+	e := newEncodeState()
+	defer encodeStatePool.Put(e)
+
+	err := e.marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err = enc.w.Write(e.Bytes()); err != nil {
+		enc.err = err
+	}
+	return err
+}
@@ -0,0 +1,175 @@
+package bencode
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// Concatenated values, as found in resume files
+const streamTest = "d1:ai1ee" + "li1ei2ee" + "5:hello" + "i-7e" + "de"
+
+var streamValues = []interface{}{
+	map[string]interface{}{"a": int64(1)},
+	[]interface{}{int64(1), int64(2)},
+	"hello",
+	int64(-7),
+	map[string]interface{}{},
+}
+
+func TestDecoder(t *testing.T) {
+	// OneByteReader makes sure values spanning refills are handled
+	for _, r := range []io.Reader{
+		strings.NewReader(streamTest),
+		iotest.OneByteReader(strings.NewReader(streamTest)),
+	} {
+		dec := NewDecoder(r)
+		var got []interface{}
+		var offsets []int64
+		for dec.More() {
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, v)
+			offsets = append(offsets, dec.InputOffset())
+		}
+		if !reflect.DeepEqual(got, streamValues) {
+			t.Errorf("got %#v, want %#v", got, streamValues)
+		}
+		if want := []int64{8, 16, 23, 27, 29}; !reflect.DeepEqual(offsets, want) {
+			t.Errorf("got offsets %v, want %v", offsets, want)
+		}
+		var v interface{}
+		if err := dec.Decode(&v); err != io.EOF {
+			t.Errorf("got %v at end of stream, want io.EOF", err)
+		}
+	}
+}
+
+func TestDecoderDoesNotReadAhead(t *testing.T) {
+	// The trailing garbage is only looked at once another value is requested
+	dec := NewDecoder(strings.NewReader("i1e?"))
+	var n int
+	if err := dec.Decode(&n); err != nil || n != 1 {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if err := dec.Decode(&n); err == nil {
+		t.Fatal("expected syntax error")
+	} else if se, ok := err.(*SyntaxError); !ok || se.Offset != 4 {
+		t.Fatalf("got %#v, want *SyntaxError at offset 4", err)
+	}
+}
+
+func TestDecoderUnexpectedEOF(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("li1e"))
+	var v interface{}
+	if err := dec.Decode(&v); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, v := range []interface{}{
+		map[string]int{"a": 1},
+		[]int{1, 2},
+		"hello",
+		-7,
+		map[string]int{},
+	} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := buf.String(); got != streamTest {
+		t.Errorf("got %q, want %q", got, streamTest)
+	}
+}
+
+func TestDecoderStrict(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("d1:ai1ee" + "d1:bi1e1:ai1ee"))
+	dec.Strict()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&v); err == nil {
+		t.Fatal("expected error for unsorted keys")
+	} else if se, ok := err.(*SyntaxError); !ok || se.Offset != 18 || se.Path != "a" {
+		t.Fatalf("got %#v, want *SyntaxError at a, offset 18", err)
+	}
+}
+
+func TestDecoderErrorOffset(t *testing.T) {
+	// Offsets of type errors are in the whole stream, not the value
+	dec := NewDecoder(strings.NewReader("d1:ai1ee" + "d1:a1:xe"))
+	var v map[string]int
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	err := dec.Decode(&v)
+	if ute, ok := err.(*UnmarshalTypeError); !ok || ute.Offset != 12 || ute.Path != "a" {
+		t.Fatalf("got %#v, want *UnmarshalTypeError at a, offset 12", err)
+	}
+}
+
+func TestDecoderLimits(t *testing.T) {
+	for _, tt := range []struct {
+		in     string
+		limits Limits
+		limit  string
+		offset int64
+	}{
+		{"llleee", Limits{MaxDepth: 2}, "MaxDepth", 3},
+		{"d1:ald1:al1:aeeee", Limits{MaxDepth: 3}, "MaxDepth", 10},
+		{"4:abcd", Limits{MaxStringLength: 3}, "MaxStringLength", 1},
+		{"l1:a99999999999:", Limits{MaxStringLength: 1 << 20}, "MaxStringLength", 11},
+		{"li1ei2ee", Limits{MaxTotalBytes: 7}, "MaxTotalBytes", 8},
+	} {
+		dec := NewDecoder(strings.NewReader(tt.in))
+		dec.SetLimits(tt.limits)
+		var v interface{}
+		err := dec.Decode(&v)
+		le, ok := err.(*LimitError)
+		if !ok {
+			t.Errorf("%q: got %v, want *LimitError", tt.in, err)
+			continue
+		}
+		if le.Limit != tt.limit || le.Offset != tt.offset {
+			t.Errorf("%q: got %s at offset %d, want %s at %d", tt.in, le.Limit, le.Offset, tt.limit, tt.offset)
+		}
+	}
+
+	// Values right at the limits are fine
+	dec := NewDecoder(strings.NewReader("ll3:abceei1e"))
+	dec.SetLimits(Limits{MaxDepth: 2, MaxStringLength: 3, MaxTotalBytes: 9})
+	var v interface{}
+	for dec.More() {
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUnmarshalDefaultMaxDepth(t *testing.T) {
+	deep := strings.Repeat("l", DefaultMaxDepth+1) + strings.Repeat("e", DefaultMaxDepth+1)
+	var v interface{}
+	if _, ok := Unmarshal([]byte(deep), &v).(*LimitError); !ok {
+		t.Error("expected *LimitError for nesting beyond DefaultMaxDepth")
+	}
+	if err := Unmarshal([]byte(deep[1:len(deep)-1]), &v); err != nil {
+		t.Error(err)
+	}
+
+	// An explicit limit can raise the default
+	dec := NewDecoder(strings.NewReader(deep))
+	dec.SetLimits(Limits{MaxDepth: DefaultMaxDepth + 1})
+	if err := dec.Decode(&v); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,46 @@
+package bencode
+
+import (
+	"reflect"
+	"strings"
+)
+
+// tag is the parsed form of a `bencode:"key,opt1,opt2"` struct tag. The
+// options are:
+//
+//	omitempty                    leave the field out when it is empty
+//	ignore_unmarshal_type_error  keep decoding when the value doesn't fit the field
+//	inline                       merge the keys of a struct field into the parent
+//
+// Embedded structs without a key are inlined as well.
+type tag []string
+
+func getTag(st reflect.StructTag) tag {
+	return strings.Split(st.Get("bencode"), ",")
+}
+
+// Ignore reports whether the field should be skipped entirely. As with
+// encoding/json, a tag of "-," gives the field the key "-" instead.
+func (t tag) Ignore() bool {
+	return t[0] == "-" && len(t) == 1
+}
+
+// Key returns the dictionary key of the field, empty means use the field name
+func (t tag) Key() string {
+	return t[0]
+}
+
+// HasOpt reports whether the option opt is present
+func (t tag) HasOpt(opt string) bool {
+	for _, s := range t[1:] {
+		if s == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// OmitEmpty reports whether the field is left out when it is empty
+func (t tag) OmitEmpty() bool {
+	return t.HasOpt("omitempty")
+}
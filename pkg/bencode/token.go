@@ -0,0 +1,349 @@
+package bencode
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// TokenKind identifies what a Token holds
+type TokenKind int
+
+// Token kinds
+const (
+	TokenInvalid   TokenKind = iota
+	TokenInt                 // an integer, Value holds its digits
+	TokenBytes               // a byte string, Value holds its content
+	TokenKey                 // a byte string used as dictionary key
+	TokenListStart           // 'l'
+	TokenDictStart           // 'd'
+	TokenListEnd             // 'e' closing a list
+	TokenDictEnd             // 'e' closing a dictionary
+)
+
+// String : convert type TokenKind to string
+func (k TokenKind) String() string {
+	switch k {
+	case TokenInt:
+		return "int"
+	case TokenBytes:
+		return "bytes"
+	case TokenKey:
+		return "key"
+	case TokenListStart:
+		return "list start"
+	case TokenDictStart:
+		return "dict start"
+	case TokenListEnd:
+		return "list end"
+	case TokenDictEnd:
+		return "dict end"
+	}
+	return "invalid"
+}
+
+// Token is a single lexical element of BENCODE input. Value is a slice of
+// the input buffer, it is not copied and is only valid as long as the
+// buffer is.
+type Token struct {
+	Kind   TokenKind
+	Value  []byte
+	Offset int // offset of the first byte of the token in the input
+}
+
+// Int parses the value of an integer token
+func (tok Token) Int() (int64, error) {
+	if tok.Kind != TokenInt {
+		return 0, &UnmarshalTypeError{Value: tok.Kind.String(), Type: reflect.TypeOf(int64(0)), Offset: int64(tok.Offset)}
+	}
+	n, ok := parseInt(tok.Value)
+	if !ok {
+		return 0, &strconv.NumError{Func: "ParseInt", Num: string(tok.Value), Err: strconv.ErrRange}
+	}
+	return n, nil
+}
+
+// Equal reports whether the token value is s, without allocating
+func (tok Token) Equal(s string) bool {
+	return string(tok.Value) == s
+}
+
+// parseInt parses digits validated by the tokenizer, without allocating
+func parseInt(b []byte) (n int64, ok bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+	neg := b[0] == '-'
+	if neg {
+		b = b[1:]
+	}
+	// Accumulate negatively so that math.MinInt64 fits
+	for _, c := range b {
+		d := int64(c - '0')
+		if n < (math.MinInt64+d)/10 {
+			return 0, false
+		}
+		n = n*10 - d
+	}
+	if !neg {
+		if n == math.MinInt64 {
+			return 0, false
+		}
+		n = -n
+	}
+	return n, true
+}
+
+// Container states kept on the Tokenizer stack
+const (
+	tokInList = iota
+	tokInDictKey
+	tokInDictValue
+)
+
+// Tokenizer splits BENCODE input into tokens without reflection and without
+// allocating, for hot paths like extended handshakes and DHT messages where
+// Unmarshal is too heavy. The zero value is ready to use after Reset.
+type Tokenizer struct {
+	data  []byte
+	off   int
+	stack []uint8
+	done  bool
+	err   error
+
+	// noPath leaves the Path of syntax errors empty, for the Tokenizer
+	// pathAt uses to find it
+	noPath bool
+}
+
+// NewTokenizer returns a Tokenizer reading the single value in data
+func NewTokenizer(data []byte) *Tokenizer {
+	t := new(Tokenizer)
+	t.Reset(data)
+	return t
+}
+
+// Reset makes the Tokenizer read data from the start, keeping its buffers
+// so it can be reused without allocating
+func (t *Tokenizer) Reset(data []byte) {
+	t.data = data
+	t.off = 0
+	t.stack = t.stack[:0]
+	t.done = false
+	t.err = nil
+}
+
+// Offset returns the number of bytes consumed so far
+func (t *Tokenizer) Offset() int {
+	return t.off
+}
+
+// Depth returns the number of containers the Tokenizer is currently inside
+func (t *Tokenizer) Depth() int {
+	return len(t.stack)
+}
+
+// Next returns the next token. It returns io.EOF once the top-level value is
+// complete; any data after it is an error.
+func (t *Tokenizer) Next() (tok Token, err error) {
+	if t.err != nil {
+		return tok, t.err
+	}
+	if t.done {
+		if t.off < len(t.data) {
+			return tok, t.syntaxError("invalid character "+quoteChar(t.data[t.off])+" after top-level value", t.off+1)
+		}
+		return tok, io.EOF
+	}
+	if t.off >= len(t.data) {
+		return tok, t.syntaxError("unexpected end of BENCODE input", len(t.data))
+	}
+
+	top := -1
+	if len(t.stack) > 0 {
+		top = int(t.stack[len(t.stack)-1])
+	}
+	c := t.data[t.off]
+	tok.Offset = t.off
+
+	if c == 'e' && (top == tokInList || top == tokInDictKey) {
+		tok.Kind = TokenListEnd
+		if top == tokInDictKey {
+			tok.Kind = TokenDictEnd
+		}
+		t.off++
+		t.stack = t.stack[:len(t.stack)-1]
+		t.valueDone()
+		return tok, nil
+	}
+
+	if top == tokInDictKey {
+		if c < '0' || c > '9' {
+			return tok, t.syntaxError("invalid character "+quoteChar(c)+" looking for beginning of dictionary key", t.off+1)
+		}
+		tok.Kind = TokenKey
+		if tok.Value, err = t.readBytes(); err != nil {
+			return tok, err
+		}
+		t.stack[len(t.stack)-1] = tokInDictValue
+		return tok, nil
+	}
+
+	switch {
+	case c == 'i':
+		tok.Kind = TokenInt
+		if tok.Value, err = t.readInt(); err != nil {
+			return tok, err
+		}
+		t.valueDone()
+	case '0' <= c && c <= '9':
+		tok.Kind = TokenBytes
+		if tok.Value, err = t.readBytes(); err != nil {
+			return tok, err
+		}
+		t.valueDone()
+	case c == 'l':
+		tok.Kind = TokenListStart
+		t.off++
+		t.stack = append(t.stack, tokInList)
+	case c == 'd':
+		tok.Kind = TokenDictStart
+		t.off++
+		t.stack = append(t.stack, tokInDictKey)
+	default:
+		return tok, t.syntaxError("invalid character "+quoteChar(c)+" looking for beginning of value", t.off+1)
+	}
+	return tok, nil
+}
+
+// Skip consumes the next value, including everything nested in it. Called
+// after a TokenKey it skips the value of that key.
+func (t *Tokenizer) Skip() error {
+	depth := len(t.stack)
+	for {
+		if _, err := t.Next(); err != nil {
+			return err
+		}
+		if len(t.stack) == depth {
+			return nil
+		}
+	}
+}
+
+// valueDone updates the enclosing container after a complete value
+func (t *Tokenizer) valueDone() {
+	n := len(t.stack)
+	if n == 0 {
+		t.done = true
+		return
+	}
+	if t.stack[n-1] == tokInDictValue {
+		t.stack[n-1] = tokInDictKey
+	}
+}
+
+// readInt reads "i<digits>e" at t.off and returns the digits
+func (t *Tokenizer) readInt() ([]byte, error) {
+	start := t.off + 1
+	end := bytes.IndexByte(t.data[start:], 'e')
+	if end < 0 {
+		return nil, t.syntaxError("unexpected end of BENCODE input", len(t.data))
+	}
+	v := t.data[start : start+end]
+	digits := v
+	if len(digits) > 0 && digits[0] == '-' {
+		digits = digits[1:]
+	}
+	if len(digits) == 0 {
+		return nil, t.syntaxError("invalid character 'e' in numeric literal", start+end+1)
+	}
+	for i, c := range digits {
+		if c < '0' || c > '9' {
+			return nil, t.syntaxError("invalid character "+quoteChar(c)+" in numeric literal", start+end-len(digits)+i+1)
+		}
+	}
+	t.off = start + end + 1
+	return v, nil
+}
+
+// readBytes reads "<length>:<content>" at t.off and returns the content
+func (t *Tokenizer) readBytes() ([]byte, error) {
+	i := t.off
+	var n int
+	for ; i < len(t.data) && t.data[i] != ':'; i++ {
+		c := t.data[i]
+		if c < '0' || c > '9' {
+			return nil, t.syntaxError("invalid character "+quoteChar(c)+" in byte string length", i+1)
+		}
+		if int64(n) >= maxStringLength {
+			return nil, t.syntaxError("invalid character "+quoteChar(c)+" in byte string length, length too large", i+1)
+		}
+		n = n*10 + int(c-'0')
+	}
+	if i >= len(t.data) || len(t.data)-i-1 < n {
+		return nil, t.syntaxError("unexpected end of BENCODE input", len(t.data))
+	}
+	i++
+	t.off = i + n
+	return t.data[i:t.off:t.off], nil
+}
+
+// syntaxError stops the Tokenizer, off is the number of bytes read
+// including the offending one, the same as the scanner reports
+func (t *Tokenizer) syntaxError(msg string, off int) error {
+	t.off = off
+	se := &SyntaxError{msg: msg, Offset: int64(off)}
+	if !t.noPath {
+		se.Path = pathAt(t.data, se.Offset)
+	}
+	t.err = se
+	return t.err
+}
+
+// AppendInt appends the encoding of i to dst and returns the extended buffer
+func AppendInt(dst []byte, i int64) []byte {
+	dst = append(dst, 'i')
+	dst = strconv.AppendInt(dst, i, 10)
+	return append(dst, 'e')
+}
+
+// AppendUint appends the encoding of i to dst and returns the extended buffer
+func AppendUint(dst []byte, i uint64) []byte {
+	dst = append(dst, 'i')
+	dst = strconv.AppendUint(dst, i, 10)
+	return append(dst, 'e')
+}
+
+// AppendBytes appends the encoding of the byte string b to dst
+func AppendBytes(dst []byte, b []byte) []byte {
+	dst = strconv.AppendInt(dst, int64(len(b)), 10)
+	dst = append(dst, ':')
+	return append(dst, b...)
+}
+
+// AppendString appends the encoding of s as a byte string to dst
+func AppendString(dst []byte, s string) []byte {
+	dst = strconv.AppendInt(dst, int64(len(s)), 10)
+	dst = append(dst, ':')
+	return append(dst, s...)
+}
+
+// AppendList appends the start of a list to dst. The elements are appended
+// next and the list is closed with AppendEnd.
+func AppendList(dst []byte) []byte {
+	return append(dst, 'l')
+}
+
+// AppendDict appends the start of a dictionary to dst. Keys and values are
+// appended next, alternating, and the dictionary is closed with AppendEnd.
+// Keys must be appended in sorted order for the output to be canonical.
+func AppendDict(dst []byte) []byte {
+	return append(dst, 'd')
+}
+
+// AppendEnd closes the innermost list or dictionary
+func AppendEnd(dst []byte) []byte {
+	return append(dst, 'e')
+}
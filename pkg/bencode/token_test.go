@@ -0,0 +1,264 @@
+package bencode
+
+import (
+	"io"
+	"io/ioutil"
+	"math"
+	"testing"
+)
+
+// A BEP 10 extended handshake, the kind of message parsed once per peer
+const extendedHandshake = "d1:md11:ut_metadatai3e6:ut_pexi1ee13:metadata_sizei31235e1:pi6881e4:reqqi500e1:v13:Tixati 2.57.0e"
+
+type extendedHandshakeMsg struct {
+	M            map[string]int `bencode:"m"`
+	MetadataSize int            `bencode:"metadata_size"`
+	Port         int            `bencode:"p"`
+	Reqq         int            `bencode:"reqq"`
+	Version      string         `bencode:"v"`
+}
+
+func TestTokenizer(t *testing.T) {
+	tz := NewTokenizer([]byte("d1:ali1e2:xye1:bdee"))
+	want := []struct {
+		kind  TokenKind
+		value string
+	}{
+		{TokenDictStart, ""},
+		{TokenKey, "a"},
+		{TokenListStart, ""},
+		{TokenInt, "1"},
+		{TokenBytes, "xy"},
+		{TokenListEnd, ""},
+		{TokenKey, "b"},
+		{TokenDictStart, ""},
+		{TokenDictEnd, ""},
+		{TokenDictEnd, ""},
+	}
+	for i, w := range want {
+		tok, err := tz.Next()
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if tok.Kind != w.kind || string(tok.Value) != w.value {
+			t.Errorf("#%d: got %v %q, want %v %q", i, tok.Kind, tok.Value, w.kind, w.value)
+		}
+	}
+	if _, err := tz.Next(); err != io.EOF {
+		t.Errorf("got %v at end, want io.EOF", err)
+	}
+}
+
+func TestTokenizerSyntaxError(t *testing.T) {
+	for _, tt := range syntaxErrorTests {
+		tz := NewTokenizer([]byte(tt.in))
+		var err error
+		for err == nil {
+			_, err = tz.Next()
+		}
+		se, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("%q: got %v, want *SyntaxError", tt.in, err)
+			continue
+		}
+		if se.Offset != tt.offset {
+			t.Errorf("%q: offset %d, want %d", tt.in, se.Offset, tt.offset)
+		}
+	}
+}
+
+func TestTokenizerSkip(t *testing.T) {
+	tz := NewTokenizer([]byte("d1:ald1:xi1eee1:bi2ee"))
+	tz.Next()
+	tz.Next()
+	if err := tz.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := tz.Next()
+	if tok.Kind != TokenKey || !tok.Equal("b") {
+		t.Fatalf("got %v %q after Skip", tok.Kind, tok.Value)
+	}
+}
+
+func TestTokenInt(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{"i0e", 0, true},
+		{"i-12e", -12, true},
+		{"i9223372036854775807e", math.MaxInt64, true},
+		{"i-9223372036854775808e", math.MinInt64, true},
+		{"i9223372036854775808e", 0, false},
+		{"i-9223372036854775809e", 0, false},
+	} {
+		tok, err := NewTokenizer([]byte(tt.in)).Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := tok.Int()
+		if (err == nil) != tt.ok || n != tt.want {
+			t.Errorf("%s: got %d, %v", tt.in, n, err)
+		}
+	}
+}
+
+func appendExtendedHandshake(b []byte) []byte {
+	b = AppendDict(b)
+	b = AppendString(b, "m")
+	b = AppendDict(b)
+	b = AppendString(b, "ut_metadata")
+	b = AppendInt(b, 3)
+	b = AppendString(b, "ut_pex")
+	b = AppendInt(b, 1)
+	b = AppendEnd(b)
+	b = AppendString(b, "metadata_size")
+	b = AppendInt(b, 31235)
+	b = AppendString(b, "p")
+	b = AppendInt(b, 6881)
+	b = AppendString(b, "reqq")
+	b = AppendUint(b, 500)
+	b = AppendString(b, "v")
+	b = AppendBytes(b, []byte("Tixati 2.57.0"))
+	return AppendEnd(b)
+}
+
+func TestAppend(t *testing.T) {
+	if got := string(appendExtendedHandshake(nil)); got != extendedHandshake {
+		t.Errorf("got %q, want %q", got, extendedHandshake)
+	}
+	b, err := Marshal(extendedHandshakeMsg{
+		M:            map[string]int{"ut_metadata": 3, "ut_pex": 1},
+		MetadataSize: 31235,
+		Port:         6881,
+		Reqq:         500,
+		Version:      "Tixati 2.57.0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != extendedHandshake {
+		t.Errorf("Marshal = %q, want %q", b, extendedHandshake)
+	}
+}
+
+// parseExtendedHandshake is how a hot path would use the Tokenizer
+func parseExtendedHandshake(tz *Tokenizer, data []byte) (metadataSize int64, err error) {
+	tz.Reset(data)
+	if _, err = tz.Next(); err != nil {
+		return
+	}
+	for {
+		var tok Token
+		tok, err = tz.Next()
+		if err != nil || tok.Kind == TokenDictEnd {
+			return
+		}
+		if !tok.Equal("metadata_size") {
+			if err = tz.Skip(); err != nil {
+				return
+			}
+			continue
+		}
+		if tok, err = tz.Next(); err != nil {
+			return
+		}
+		if metadataSize, err = tok.Int(); err != nil {
+			return
+		}
+	}
+}
+
+func TestTokenizerAllocs(t *testing.T) {
+	data := []byte(extendedHandshake)
+	var tz Tokenizer
+	allocs := testing.AllocsPerRun(100, func() {
+		if n, err := parseExtendedHandshake(&tz, data); err != nil || n != 31235 {
+			t.Fatalf("got %d, %v", n, err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("got %v allocs per run, want 0", allocs)
+	}
+	buf := make([]byte, 0, 256)
+	allocs = testing.AllocsPerRun(100, func() {
+		buf = appendExtendedHandshake(buf[:0])
+	})
+	if allocs != 0 {
+		t.Errorf("got %v allocs per append, want 0", allocs)
+	}
+}
+
+func BenchmarkTokenizerExtendedHandshake(b *testing.B) {
+	data := []byte(extendedHandshake)
+	var tz Tokenizer
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		parseExtendedHandshake(&tz, data)
+	}
+}
+
+func BenchmarkUnmarshalExtendedHandshake(b *testing.B) {
+	data := []byte(extendedHandshake)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		var msg extendedHandshakeMsg
+		Unmarshal(data, &msg)
+	}
+}
+
+func BenchmarkAppendExtendedHandshake(b *testing.B) {
+	buf := make([]byte, 0, 256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = appendExtendedHandshake(buf[:0])
+	}
+}
+
+func BenchmarkMarshalExtendedHandshake(b *testing.B) {
+	msg := extendedHandshakeMsg{
+		M:            map[string]int{"ut_metadata": 3, "ut_pex": 1},
+		MetadataSize: 31235,
+		Port:         6881,
+		Reqq:         500,
+		Version:      "Tixati 2.57.0",
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Marshal(msg)
+	}
+}
+
+func BenchmarkTokenizerTorrent(b *testing.B) {
+	data, err := ioutil.ReadFile("../../test/data/debian-9.1.0-amd64-netinst.iso.torrent")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var tz Tokenizer
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		tz.Reset(data)
+		for {
+			if _, err := tz.Next(); err != nil {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkUnmarshalTorrent(b *testing.B) {
+	data, err := ioutil.ReadFile("../../test/data/debian-9.1.0-amd64-netinst.iso.torrent")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		var v interface{}
+		Unmarshal(data, &v)
+	}
+}
@@ -3,28 +3,39 @@ package bittorrentclient
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
 	"strings"
 	"sync"
 	"time"
 
 	"./network"
+	"github.com/Phantomape/bittorrent-client/pkg/metainfo"
+	"github.com/Phantomape/bittorrent-client/pkg/protocol"
+	"github.com/Phantomape/bittorrent-client/pkg/tracker"
 	"github.com/anacrolix/dht"
 	"github.com/anacrolix/missinggo"
 	"github.com/anacrolix/missinggo/bitmap"
 	"github.com/anacrolix/missinggo/perf"
 	"github.com/anacrolix/missinggo/pproffd"
-	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/peer_protocol"
 	"github.com/anacrolix/torrent/storage"
 )
 
 var allNetworkProtocols = []string{"tcp4", "tcp6", "udp4", "udp6"}
 
+// Connections to the peers of a torrent
+const (
+	establishedConnsPerTorrent = 50
+	halfOpenConnsPerTorrent    = 25 // being dialed or handshaking
+	dialTimeout                = 20 * time.Second
+)
+
 // defaultPeerExtensionBytes : default reserved bytes
 func defaultPeerExtensionBytes() peer_protocol.PeerExtensionBits {
 	return peer_protocol.NewPeerExtensionBytes(peer_protocol.ExtensionBitFast)
@@ -45,10 +56,20 @@ type ClientConfig struct {
 
 // Torrent : parsed information about the torrent
 type Torrent struct {
+	// Piece data exchanged with peers, reported to trackers. Updated by the
+	// connections without the client locked, accessed atomically. First so
+	// they are 64-bit aligned on 32-bit platforms.
+	bytesDownloaded int64
+	bytesUploaded   int64
+
 	c               *Client
 	info            *metainfo.Info
 	infoHash        metainfo.Hash
 	metaInfo        *metainfo.MetaInfo
+	announcer       *tracker.Announcer
+	stopAnnouncing  func()           // nil until the announcer runs
+	peers           prioritizedPeers // known peers not connected to
+	halfOpen        int              // outgoing connections not handshaken yet
 	storageClient   *storage.Client
 	closed          missinggo.Event
 	pendingRequests map[request]int
@@ -108,6 +129,56 @@ func (t *Torrent) dropConnection(conn *Connection) {
 	}
 }
 
+// pieceCompleted : record that piece is verified, the trackers hear about it
+// once all the pieces are. With the client locked.
+func (t *Torrent) pieceCompleted(piece int) {
+	if t.completedPieces.Contains(piece) {
+		return
+	}
+	t.completedPieces.Add(piece)
+	if t.haveAllPieces() {
+		t.announcer.Completed()
+	}
+}
+
+// bytesLeft : bytes of the torrent data still to download. Padding files
+// don't count, they are never downloaded. Without the info the amount is
+// unknown, the most there can be is reported so trackers don't take the
+// torrent for a seed.
+func (t *Torrent) bytesLeft() int64 {
+	if !t.haveInfo() {
+		return math.MaxInt64
+	}
+	left := t.info.DataLength()
+	t.completedPieces.IterTyped(func(piece int) bool {
+		left -= t.info.PieceDataLength(piece)
+		return true
+	})
+	return left
+}
+
+// Drop : remove the torrent from the client, the trackers are told it stopped
+func (t *Torrent) Drop() {
+	t.c.lock()
+	defer t.c.unlock()
+	t.close()
+	delete(t.c.torrents, t.infoHash)
+}
+
+// close : stop announcing and close the connections, with the client locked
+func (t *Torrent) close() {
+	if t.closed.IsSet() {
+		return
+	}
+	t.closed.Set()
+	if t.stopAnnouncing != nil {
+		t.stopAnnouncing()
+	}
+	for conn := range t.conns {
+		conn.Close()
+	}
+}
+
 // bitfield : generate
 func (t *Torrent) bitfield() (bf []bool) {
 	bf = make([]bool, t.numPieces())
@@ -147,9 +218,34 @@ func (c *Client) sendInitialMessages(conn *Connection, t *Torrent) {
 	// DHT support
 }
 
+// addPeers : add the peers a tracker returned to those to connect to, with
+// the client locked
+func (t *Torrent) addPeers(peers []tracker.Peer, source peerSource) {
+	for _, p := range peers {
+		if t.c.config.disableIPv6 && p.IP.To4() == nil {
+			continue
+		}
+		t.peers.Add(Peer{IP: p.IP, Port: int(p.Port), Source: source})
+	}
+	t.openNewConnections()
+}
+
 // openNewConnections : open connection with peers based on their priorities
 func (t *Torrent) openNewConnections() {
-
+	if t.closed.IsSet() || t.c.closed.IsSet() {
+		return
+	}
+	for len(t.conns)+t.halfOpen < establishedConnsPerTorrent && t.halfOpen < halfOpenConnsPerTorrent {
+		p, ok := t.peers.PopMax()
+		if !ok {
+			return
+		}
+		if t.c.isBadPeerIPPort(p.IP, p.Port) {
+			continue
+		}
+		t.halfOpen++
+		go t.c.outgoingConnection(t, p)
+	}
 }
 
 func (t *Torrent) deleteConnection(conn *Connection) (res bool) {
@@ -179,11 +275,13 @@ type Client struct {
 	config         *ClientConfig
 	conns          []network.Socket
 	mu             sync.RWMutex
-	torrents       map[metainfo.Hash]*Torrent // Where is the InfoHash type ?
+	torrents       map[metainfo.Hash]*Torrent
 	defaultStorage *storage.Client
 	dhtServers     []*dht.Server // why is dht a server T.T
 	extensionBytes peer_protocol.PeerExtensionBits
 	peerID         [20]byte
+	announceKey    int32          // identifies the client to trackers when its IP changes
+	announcers     sync.WaitGroup // running announcers of the torrents
 	event          sync.Cond
 }
 
@@ -218,6 +316,50 @@ func (c *Client) AddTorrentInfoHash(infoHash metainfo.Hash) (t *Torrent, new boo
 	return c.AddTorrentInfoHashWithStorage(infoHash, nil)
 }
 
+// AddMagnet : add the torrent a magnet link points to, its metadata has to
+// be fetched from peers
+func (c *Client) AddMagnet(uri string) (t *Torrent, err error) {
+	m, err := metainfo.ParseMagnet(uri)
+	if err != nil {
+		return
+	}
+	t, _ = c.AddTorrentInfoHash(m.WireHash())
+	// Like most clients, each tracker of a magnet link is a tier of its own
+	var tiers [][]string
+	for _, tr := range m.Trackers {
+		tiers = append(tiers, []string{tr})
+	}
+	c.lock()
+	t.addTrackers(tiers)
+	c.unlock()
+	return
+}
+
+// AddTorrent : add the torrent a metainfo file describes
+func (c *Client) AddTorrent(mi *metainfo.MetaInfo) (t *Torrent, err error) {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return
+	}
+	if problems := info.Validate(); problems != nil {
+		err = problems[0]
+		return
+	}
+	m, err := mi.Magnet()
+	if err != nil {
+		return
+	}
+	t, _ = c.AddTorrentInfoHash(m.WireHash())
+	c.lock()
+	defer c.unlock()
+	if !t.haveInfo() {
+		t.metaInfo = mi
+		t.info = &info
+	}
+	t.addTrackers(mi.UpvertedAnnounceList())
+	return
+}
+
 // AddTorrentInfoHashWithStorage : add torrent with custom Storage implementation
 func (c *Client) AddTorrentInfoHashWithStorage(infoHash metainfo.Hash, storageSpec storage.ClientImpl) (t *Torrent, new bool) {
 	c.lock()
@@ -229,6 +371,7 @@ func (c *Client) AddTorrentInfoHashWithStorage(infoHash metainfo.Hash, storageSp
 	new = true
 
 	t = c.newTorrent(infoHash, storageSpec)
+	c.torrents[infoHash] = t
 	return
 }
 
@@ -243,7 +386,9 @@ func (c *Client) newTorrent(infoHash metainfo.Hash, storageSpec storage.ClientIm
 		c:             c,
 		infoHash:      infoHash,
 		storageClient: storageClient,
+		conns:         make(map[*Connection]struct{}),
 	}
+	t.announcer = tracker.NewAnnouncer(torrentAnnouncer{t})
 	return
 }
 
@@ -277,8 +422,14 @@ func enabledNetworkProtocol(network string, cfg *ClientConfig) bool {
 // Close : stops the client and sever all connections
 func (c *Client) Close() {
 	c.lock()
-	defer c.unlock()
+	c.closed.Set()
+	for _, t := range c.torrents {
+		t.close()
+	}
 	// TODO: close socket
+	c.unlock()
+	// Give the trackers the time to hear the torrents stopped
+	c.announcers.Wait()
 }
 
 // NewClient : client constructor
@@ -306,6 +457,11 @@ func NewClient(cfg *ClientConfig) (c *Client, err error) {
 			panic("error generating peer id")
 		}
 	}
+	var key [4]byte
+	if _, err = rand.Read(key[:]); err != nil {
+		return
+	}
+	c.announceKey = int32(binary.BigEndian.Uint32(key[:]))
 
 	c.conns, err = network.ListenAll(c.checkEnabledNetworkProtocols(), c.config.listenHost, c.config.listenPort, c.config.proxyURL, c.firewallCallback)
 	if err != nil {
@@ -320,8 +476,13 @@ func NewClient(cfg *ClientConfig) (c *Client, err error) {
 	return
 }
 
-// LocalPort : no idea
+// LocalPort : the port the client listens on for peers, 0 if it doesn't
 func (c *Client) LocalPort() (port int) {
+	for _, s := range c.conns {
+		if port = missinggo.AddrPort(s.Addr()); port != 0 {
+			return
+		}
+	}
 	return
 }
 
@@ -390,6 +551,34 @@ func (c *Client) runReceivedConnection(conn *Connection) {
 	c.runHandshookConnection(conn, t)
 }
 
+// outgoingConnection : connect to a peer of t, and run the connection once
+// the handshake is done
+func (c *Client) outgoingConnection(t *Torrent, p Peer) {
+	var conn *Connection
+	ok := false
+	nc, err := net.DialTimeout("tcp", p.addr(), dialTimeout)
+	if err == nil {
+		conn = c.newConnection(nc, true)
+		conn.Discovery = p.Source
+		conn.setRW(nc)
+		var ih metainfo.Hash
+		ih, ok, err = c.connBTHandshake(conn, &t.infoHash)
+		ok = ok && err == nil && ih == t.infoHash
+	}
+
+	c.lock()
+	defer c.unlock()
+	t.halfOpen--
+	if !ok {
+		if nc != nil {
+			nc.Close()
+		}
+		t.openNewConnections()
+		return
+	}
+	c.runHandshookConnection(conn, t)
+}
+
 type deadlineReader struct {
 	nc net.Conn
 	r  io.Reader
@@ -452,12 +641,12 @@ func (c *Client) receiveHandshakes(conn *Connection) (t *Torrent, err error) {
 
 // connBTHandshake : the name and api sucks
 func (c *Client) connBTHandshake(conn *Connection, ih *metainfo.Hash) (ret metainfo.Hash, ok bool, err error) {
-	res, ok, err := peer_protocol.Handshake(conn.getRW(), ih, c.peerID, c.extensionBytes)
+	res, ok, err := protocol.Handshake(conn.getRW(), ih, c.peerID, protocol.PeerExtensionBytes(c.extensionBytes))
 	if err != nil || !ok {
 		return
 	}
 	ret = res.Hash
-	conn.PeerExtensionBytes = res.PeerExtensionBits
+	conn.PeerExtensionBytes = peer_protocol.PeerExtensionBits(res.PeerExtensionBytes)
 	conn.PeerID = res.PeerID
 	conn.completedHandshake = time.Now()
 	return
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/anacrolix/missinggo"
@@ -85,6 +86,7 @@ func (conn *Connection) getRemoteAddr() net.Addr {
 
 // Close : close connection
 func (conn *Connection) Close() {
+	conn.closed.Set()
 	if conn.conn != nil {
 		go conn.conn.Close()
 	}
@@ -136,7 +138,9 @@ func (conn *Connection) Post(msg peer_protocol.Message) {
 }
 
 func (conn *Connection) wroteMsg(msg *peer_protocol.Message) {
-	// no idea
+	if msg.Type == peer_protocol.Piece {
+		atomic.AddInt64(&conn.t.bytesUploaded, int64(len(msg.Piece)))
+	}
 }
 
 // writer : the go routine that writes to the peer
@@ -202,6 +206,9 @@ func (conn *Connection) mainReadLoop() (err error) {
 
 func (conn *Connection) readMsg(msg *peer_protocol.Message) {
 	// cn.allStats(func(cs *ConnStats) { cs.readMsg(msg) })
+	if msg.Type == peer_protocol.Piece {
+		atomic.AddInt64(&conn.t.bytesDownloaded, int64(len(msg.Piece)))
+	}
 }
 
 func (conn *Connection) updateRequests() {
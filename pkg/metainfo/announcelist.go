@@ -0,0 +1,28 @@
+package metainfo
+
+// AnnounceList : tiers of tracker URLs, BEP 12
+type AnnounceList [][]string
+
+// OverridesAnnounce : whether the list should be used instead of the
+// announce URL. Some clients write an announce-list of empty tiers.
+func (al AnnounceList) OverridesAnnounce(announce string) bool {
+	for _, tier := range al {
+		for _, url := range tier {
+			if url != "" || announce == "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DistinctValues : the set of all tracker URLs in the list
+func (al AnnounceList) DistinctValues() map[string]struct{} {
+	ret := make(map[string]struct{})
+	for _, tier := range al {
+		for _, url := range tier {
+			ret[url] = struct{}{}
+		}
+	}
+	return ret
+}
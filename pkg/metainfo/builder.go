@@ -0,0 +1,500 @@
+package metainfo
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Phantomape/bittorrent-client/pkg/bencode"
+)
+
+// Piece lengths chosen by ChoosePieceLength
+const (
+	MinPieceLength = 16 << 10
+	MaxPieceLength = 16 << 20
+)
+
+// maxHashingMemory : rough bound on the piece buffers used by Builder
+const maxHashingMemory = 256 << 20
+
+// ChoosePieceLength : pick a power of two piece length that splits
+// totalLength into about 1000 to 2000 pieces, within Min and MaxPieceLength
+func ChoosePieceLength(totalLength int64) int64 {
+	const targetPieces = 1500
+	pl := int64(MinPieceLength)
+	for pl < MaxPieceLength && totalLength/pl > targetPieces {
+		pl *= 2
+	}
+	return pl
+}
+
+// Version : the kind of torrent a Builder creates
+type Version int
+
+// Torrent versions
+const (
+	V1     Version = iota // BEP 3, the default
+	Hybrid                // v1 and v2 metadata for the same files, BEP 52
+	V2                    // BEP 52 only
+)
+
+// Builder : creates a torrent from a file or directory on disk
+type Builder struct {
+	Version      Version
+	Path         string       // file or directory the torrent is for
+	Name         string       // name in the info dictionary, the base name of Path if empty
+	PieceLength  int64        // chosen with ChoosePieceLength if zero
+	AnnounceList AnnounceList // tiers of trackers
+	Comment      string
+	CreatedBy    string
+	CreationDate int64 // seconds since the Unix epoch, left out if zero
+	Private      bool
+	Source       string
+	URLList      []string // web seeds
+	Workers      int      // goroutines hashing pieces, runtime.NumCPU() if zero
+
+	// PadFiles makes every file of a v1 torrent start on a piece boundary
+	// by inserting padding files, BEP 47. Hybrid torrents are always padded.
+	PadFiles bool
+}
+
+// builderFile : a file to include, with its location on disk
+type builderFile struct {
+	FileInfo
+	osPath string
+}
+
+// Build : walk the files and hash them into a MetaInfo
+func (b *Builder) Build() (*MetaInfo, error) {
+	info, pieceLayers, err := b.build()
+	if err != nil {
+		return nil, err
+	}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	mi := &MetaInfo{
+		Comment:      b.Comment,
+		CreatedBy:    b.CreatedBy,
+		CreationDate: b.CreationDate,
+		URLList:      b.URLList,
+		InfoBytes:    infoBytes,
+		PieceLayers:  pieceLayers,
+	}
+	mi.SetAnnounceList(b.AnnounceList)
+	return mi, nil
+}
+
+// BuildInfo : walk the files and hash them into an Info. The piece layers
+// of v2 torrents are not part of the Info, use Build to get them.
+func (b *Builder) BuildInfo() (*Info, error) {
+	info, _, err := b.build()
+	return info, err
+}
+
+func (b *Builder) build() (*Info, map[string][]byte, error) {
+	files, err := b.walk()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := &Info{Name: b.Name, PieceLength: b.PieceLength, Source: b.Source}
+	if info.Name == "" {
+		info.Name = filepath.Base(filepath.Clean(b.Path))
+	}
+	if b.Private {
+		private := true
+		info.Private = &private
+	}
+	var total int64
+	for _, f := range files {
+		total += f.Length
+	}
+	if info.PieceLength == 0 {
+		info.PieceLength = ChoosePieceLength(total)
+	}
+	single := len(files) == 1 && files[0].Path == nil
+
+	if b.Version == V1 {
+		if single {
+			info.Length = total
+			info.Attr = files[0].Attr
+		} else {
+			if b.PadFiles {
+				files = withPadding(files, info.PieceLength)
+				total = 0
+				for _, f := range files {
+					total += f.Length
+				}
+			}
+			for _, f := range files {
+				info.Files = append(info.Files, f.FileInfo)
+			}
+		}
+		if info.Pieces, err = b.hashPieces(files, info.PieceLength, total); err != nil {
+			return nil, nil, err
+		}
+		return info, nil, nil
+	}
+
+	pl := info.PieceLength
+	if pl < BlockSize || pl&(pl-1) != 0 {
+		return nil, nil, fmt.Errorf("v2 piece length %d is not a power of two of at least %d", pl, BlockSize)
+	}
+	info.MetaVersion = 2
+	hybrid := b.Version == Hybrid
+	roots, pieceLayers, pieces, err := b.hashFilesV2(files, pl, hybrid)
+	if err != nil {
+		return nil, nil, err
+	}
+	tree := FileTree{}
+	for i, f := range files {
+		path := f.Path
+		if single {
+			path = []string{info.Name}
+		}
+		tree.addFile(path, &FileTreeFile{Length: f.Length, PiecesRoot: roots[i]})
+	}
+	info.FileTree = tree.Dir
+	if hybrid {
+		info.Pieces = pieces
+		if single {
+			info.Length = total
+			info.Attr = files[0].Attr
+		} else {
+			for _, f := range withPadding(files, pl) {
+				info.Files = append(info.Files, f.FileInfo)
+			}
+		}
+	}
+	return info, pieceLayers, nil
+}
+
+// padAfter : the length of the padding a hybrid torrent has after file i,
+// so that the next file starts on a piece boundary
+func padAfter(files []builderFile, i int, pieceLength int64) int64 {
+	if i == len(files)-1 || files[i].Length%pieceLength == 0 {
+		return 0
+	}
+	return pieceLength - files[i].Length%pieceLength
+}
+
+// withPadding : the files with padding files between them so each file
+// starts on a piece boundary, BEP 47. Padding files read as zeros.
+func withPadding(files []builderFile, pieceLength int64) (ret []builderFile) {
+	for i, f := range files {
+		ret = append(ret, f)
+		if pad := padAfter(files, i, pieceLength); pad != 0 {
+			ret = append(ret, builderFile{FileInfo: FileInfo{
+				Length: pad,
+				Path:   []string{".pad", strconv.FormatInt(pad, 10)},
+				Attr:   string(AttrPadding),
+			}})
+		}
+	}
+	return
+}
+
+// fileAttr : the BEP 47 attributes of a file found by walk
+func fileAttr(fi os.FileInfo) string {
+	if fi.Mode()&0111 != 0 {
+		return string(AttrExecutable)
+	}
+	return ""
+}
+
+// walk : list the regular files under b.Path in lexical order
+func (b *Builder) walk() (files []builderFile, err error) {
+	fi, err := os.Stat(b.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []builderFile{{FileInfo{Length: fi.Size(), Attr: fileAttr(fi)}, b.Path}}, nil
+	}
+	err = filepath.Walk(b.Path, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(b.Path, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, builderFile{
+			FileInfo{Length: fi.Size(), Path: strings.Split(filepath.ToSlash(rel), "/"), Attr: fileAttr(fi)},
+			path,
+		})
+		return nil
+	})
+	if err == nil && len(files) == 0 {
+		err = fmt.Errorf("no files found in %s", b.Path)
+	}
+	return
+}
+
+// hashPieces : read the files as one stream and hash it piece by piece.
+// Reading is sequential since that is what disks are good at, the hashing
+// is spread over the workers.
+func (b *Builder) hashPieces(files []builderFile, pieceLength, total int64) ([]byte, error) {
+	numPieces := int((total + pieceLength - 1) / pieceLength)
+	pieces := make([]byte, numPieces*HashSize)
+
+	workers := b.workers()
+	type job struct {
+		index int
+		buf   []byte
+	}
+	jobs := make(chan job)
+	free := pieceBuffers(workers, pieceLength)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				h := sha1.Sum(j.buf)
+				copy(pieces[j.index*HashSize:], h[:])
+				free <- j.buf[:cap(j.buf)]
+			}
+		}()
+	}
+
+	r := &filesReader{files: files}
+	defer r.Close()
+	var err error
+	for i := 0; i < numPieces; i++ {
+		buf := <-free
+		if remaining := total - int64(i)*pieceLength; remaining < pieceLength {
+			buf = buf[:remaining]
+		}
+		if _, err = io.ReadFull(r, buf); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = errors.New("files shrank while hashing them")
+			}
+			break
+		}
+		jobs <- job{i, buf}
+	}
+	close(jobs)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return pieces, nil
+}
+
+// hashFilesV2 : hash each file on its own into merkle trees, returning the
+// pieces root of each file and the piece layers. With v1 set the files are
+// also hashed as v1 pieces, as if padded to a piece boundary.
+func (b *Builder) hashFilesV2(files []builderFile, pieceLength int64, v1 bool) (roots [][]byte, pieceLayers map[string][]byte, pieces []byte, err error) {
+	layers := make([][]HashV2, len(files))
+	leaves := make([][]HashV2, len(files)) // only for files up to a piece long
+	firstPiece := make([]int, len(files))  // v1 index of the first piece of each file
+	numPieces := 0
+	for i, f := range files {
+		firstPiece[i] = numPieces
+		n := int((f.Length + pieceLength - 1) / pieceLength)
+		layers[i] = make([]HashV2, n)
+		numPieces += n
+	}
+	if v1 {
+		pieces = make([]byte, numPieces*HashSize)
+	}
+	blocksPerPiece := int(pieceLength / BlockSize)
+
+	workers := b.workers()
+	type job struct {
+		file, piece int
+		buf         []byte
+		pad         int64 // zeros following the piece in the v1 data
+	}
+	jobs := make(chan job)
+	free := pieceBuffers(workers, pieceLength)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var zeros [BlockSize]byte
+			for j := range jobs {
+				hashes := blockHashes(j.buf)
+				if files[j.file].Length <= pieceLength {
+					leaves[j.file] = hashes
+				}
+				layers[j.file][j.piece] = merkleRoot(hashes, blocksPerPiece, HashV2{})
+				if v1 {
+					h := sha1.New()
+					h.Write(j.buf)
+					for pad := j.pad; pad > 0; pad -= BlockSize {
+						if pad < BlockSize {
+							h.Write(zeros[:pad])
+							break
+						}
+						h.Write(zeros[:])
+					}
+					copy(pieces[(firstPiece[j.file]+j.piece)*HashSize:], h.Sum(nil))
+				}
+				free <- j.buf[:cap(j.buf)]
+			}
+		}()
+	}
+
+	for i := 0; i < len(files) && err == nil; i++ {
+		err = readPieces(files[i], pieceLength, free, func(piece int, buf []byte) {
+			j := job{file: i, piece: piece, buf: buf}
+			if piece == len(layers[i])-1 {
+				j.pad = padAfter(files, i, pieceLength)
+			}
+			jobs <- j
+		})
+	}
+	close(jobs)
+	wg.Wait()
+	if err != nil {
+		return
+	}
+
+	roots = make([][]byte, len(files))
+	pieceLayers = make(map[string][]byte)
+	for i, f := range files {
+		if f.Length == 0 {
+			continue
+		}
+		var root HashV2
+		if f.Length <= pieceLength {
+			root = merkleRoot(leaves[i], 0, HashV2{})
+		} else {
+			root = PiecesRoot(layers[i], pieceLength)
+			layer := make([]byte, 0, len(layers[i])*HashV2Size)
+			for _, h := range layers[i] {
+				layer = append(layer, h[:]...)
+			}
+			pieceLayers[root.AsString()] = layer
+		}
+		roots[i] = root.Bytes()
+	}
+	if len(pieceLayers) == 0 {
+		pieceLayers = nil
+	}
+	return
+}
+
+// readPieces : read a file piece by piece, in buffers taken from free
+func readPieces(f builderFile, pieceLength int64, free chan []byte, fn func(piece int, buf []byte)) error {
+	if f.Length == 0 {
+		return nil
+	}
+	r, err := os.Open(f.osPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for i, off := 0, int64(0); off < f.Length; i, off = i+1, off+pieceLength {
+		buf := <-free
+		if remaining := f.Length - off; remaining < pieceLength {
+			buf = buf[:remaining]
+		}
+		if _, err := io.ReadFull(r, buf); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = fmt.Errorf("%s shrank while hashing it", f.osPath)
+			}
+			return err
+		}
+		fn(i, buf)
+	}
+	return nil
+}
+
+func (b *Builder) workers() int {
+	if b.Workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return b.Workers
+}
+
+// pieceBuffers : a pool of buffers for pieces being hashed. The memory in
+// use is bound to a couple of pieces per worker, and to maxHashingMemory
+// when the pieces are large.
+func pieceBuffers(workers int, pieceLength int64) chan []byte {
+	n := 2 * workers
+	if max := int(maxHashingMemory / pieceLength); n > max {
+		n = max
+	}
+	if n < 2 {
+		n = 2
+	}
+	free := make(chan []byte, n)
+	for i := 0; i < n; i++ {
+		free <- make([]byte, pieceLength)
+	}
+	return free
+}
+
+// filesReader : read files one after the other, opening them as needed.
+// Padding files read as zeros.
+type filesReader struct {
+	files []builderFile
+	cur   *os.File
+	pad   bool  // reading a padding file rather than cur
+	left  int64 // bytes of the current file still expected
+}
+
+func (r *filesReader) Read(p []byte) (int, error) {
+	for (r.cur == nil && !r.pad) || r.left == 0 {
+		r.Close()
+		if len(r.files) == 0 {
+			return 0, io.EOF
+		}
+		next := r.files[0]
+		r.files = r.files[1:]
+		r.left = next.Length
+		if r.pad = next.IsPadding(); r.pad {
+			continue
+		}
+		f, err := os.Open(next.osPath)
+		if err != nil {
+			return 0, err
+		}
+		r.cur = f
+	}
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	if r.pad {
+		for i := range p {
+			p[i] = 0
+		}
+		r.left -= int64(len(p))
+		return len(p), nil
+	}
+	n, err := r.cur.Read(p)
+	r.left -= int64(n)
+	if err == io.EOF && r.left > 0 {
+		err = fmt.Errorf("%s shrank while hashing it", r.cur.Name())
+	} else if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Close : close the file being read
+func (r *filesReader) Close() error {
+	if r.cur == nil {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	return err
+}
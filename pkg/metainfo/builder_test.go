@@ -0,0 +1,391 @@
+package metainfo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// expectedPieces hashes data the slow way
+func expectedPieces(data []byte, pieceLength int) (pieces []byte) {
+	for len(data) > 0 {
+		n := pieceLength
+		if n > len(data) {
+			n = len(data)
+		}
+		h := sha1.Sum(data[:n])
+		pieces = append(pieces, h[:]...)
+		data = data[n:]
+	}
+	return
+}
+
+func TestBuilderDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := string(bytes.Repeat([]byte("a"), 40000))
+	c := string(bytes.Repeat([]byte("c"), 5000))
+	writeTestFiles(t, dir, map[string]string{
+		"snapshot/a.dat":      a,
+		"snapshot/empty":      "",
+		"snapshot/sub/c.dat":  c,
+		"snapshot/sub/d/e.js": "{}",
+	})
+
+	b := Builder{
+		Path:         filepath.Join(dir, "snapshot"),
+		AnnounceList: AnnounceList{{"http://a/announce"}, {"udp://b:80", "udp://c:80"}},
+		Comment:      "nightly",
+		Private:      true,
+		URLList:      []string{"http://mirror/snapshot/"},
+		Workers:      3,
+	}
+	mi, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mi.Announce != "http://a/announce" || len(mi.AnnounceList) != 2 || mi.Comment != "nightly" {
+		t.Errorf("got %+v", mi)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "snapshot" || !info.IsPrivate() || info.PieceLength != MinPieceLength {
+		t.Errorf("got %+v", info)
+	}
+	wantFiles := []FileInfo{
+		{Length: 40000, Path: []string{"a.dat"}},
+		{Length: 0, Path: []string{"empty"}},
+		{Length: 5000, Path: []string{"sub", "c.dat"}},
+		{Length: 2, Path: []string{"sub", "d", "e.js"}},
+	}
+	if !reflect.DeepEqual(info.Files, wantFiles) {
+		t.Errorf("got files %+v, want %+v", info.Files, wantFiles)
+	}
+	want := expectedPieces([]byte(a+c+"{}"), MinPieceLength)
+	if !bytes.Equal(info.Pieces, want) {
+		t.Errorf("got %d bytes of piece hashes, want %d", len(info.Pieces), len(want))
+	}
+}
+
+func TestBuilderPadFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const pieceLength = 4096
+	a := string(bytes.Repeat([]byte("a"), 5000))
+	b := string(bytes.Repeat([]byte("b"), 2*pieceLength))
+	c := "ccc"
+	writeTestFiles(t, dir, map[string]string{"p/a": a, "p/b": b, "p/c": c})
+	if err := os.Chmod(filepath.Join(dir, "p", "c"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := (&Builder{Path: filepath.Join(dir, "p"), PieceLength: pieceLength, PadFiles: true}).BuildInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFiles := []FileInfo{
+		{Length: 5000, Path: []string{"a"}},
+		{Length: 3192, Path: []string{".pad", "3192"}, Attr: "p"},
+		{Length: 2 * pieceLength, Path: []string{"b"}},
+		{Length: 3, Path: []string{"c"}, Attr: "x"},
+	}
+	if !reflect.DeepEqual(info.Files, wantFiles) {
+		t.Errorf("got files %+v, want %+v", info.Files, wantFiles)
+	}
+	padded := a + string(make([]byte, 3192)) + b + c
+	if !bytes.Equal(info.Pieces, expectedPieces([]byte(padded), pieceLength)) {
+		t.Error("piece hashes don't match the padded data")
+	}
+	if visible := info.VisibleFiles(); len(visible) != 3 || visible[1].Path[0] != "b" || !visible[2].IsExecutable() {
+		t.Errorf("got visible files %+v", visible)
+	}
+	if problems := info.Validate(); problems != nil {
+		t.Error(problems)
+	}
+	var m PathMapper
+	if paths := m.MapFiles(info); paths[1] != "" || filepath.ToSlash(paths[2]) != "p/b" {
+		t.Errorf("got paths %q", paths)
+	}
+}
+
+func TestBuilderSingleFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	writeTestFiles(t, dir, map[string]string{"file.bin": string(data)})
+
+	b := Builder{
+		Path:         filepath.Join(dir, "file.bin"),
+		PieceLength:  4096,
+		AnnounceList: AnnounceList{{"http://a/announce"}},
+	}
+	mi, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mi.Announce != "http://a/announce" || mi.AnnounceList != nil {
+		t.Errorf("a single tracker should only be in announce, got %+v", mi)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "file.bin" || info.Length != int64(len(data)) || info.Files != nil || info.Private != nil {
+		t.Errorf("got %+v", info)
+	}
+	if !bytes.Equal(info.Pieces, expectedPieces(data, 4096)) {
+		t.Error("piece hashes don't match")
+	}
+}
+
+func TestBuilderEmptyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestFiles(t, dir, map[string]string{"empty": ""})
+
+	b := Builder{Path: filepath.Join(dir, "empty")}
+	mi, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without length the info would look like a directory missing its files
+	want := "d6:lengthi0e4:name5:empty12:piece lengthi16384e6:pieces0:e"
+	if string(mi.InfoBytes) != want {
+		t.Errorf("info %q, want %q", mi.InfoBytes, want)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IsDir() || info.TotalLength() != 0 || info.NumPieces() != 0 {
+		t.Errorf("got %+v", info)
+	}
+}
+
+func TestChoosePieceLength(t *testing.T) {
+	for _, tt := range []struct {
+		total int64
+		want  int64
+	}{
+		{0, MinPieceLength},
+		{10 << 20, MinPieceLength},
+		{700 << 20, 512 << 10},
+		{4 << 30, 4 << 20},
+		{1 << 50, MaxPieceLength},
+	} {
+		if got := ChoosePieceLength(tt.total); got != tt.want {
+			t.Errorf("ChoosePieceLength(%d) = %d, want %d", tt.total, got, tt.want)
+		}
+	}
+}
+
+// naiveTree computes the v2 pieces root and piece layer of data the way
+// BEP 52 describes it: one tree over all blocks, padded with zero leaves.
+// Empty files have neither.
+func naiveTree(data []byte, pieceLength int) (root []byte, layer []byte) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var leaves [][]byte
+	for off := 0; off < len(data); off += BlockSize {
+		end := off + BlockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		h := sha256.Sum256(data[off:end])
+		leaves = append(leaves, h[:])
+	}
+	n := 1
+	for n < len(leaves) {
+		n *= 2
+	}
+	for len(leaves) < n {
+		leaves = append(leaves, make([]byte, 32))
+	}
+	numPieces := (len(data) + pieceLength - 1) / pieceLength
+	for width := BlockSize; ; width *= 2 {
+		if width == pieceLength && len(data) > pieceLength {
+			for _, h := range leaves[:numPieces] {
+				layer = append(layer, h...)
+			}
+		}
+		if len(leaves) == 1 {
+			return leaves[0], layer
+		}
+		var next [][]byte
+		for i := 0; i < len(leaves); i += 2 {
+			h := sha256.Sum256(append(append([]byte{}, leaves[i]...), leaves[i+1]...))
+			next = append(next, h[:])
+		}
+		leaves = next
+	}
+}
+
+func TestBuilderV2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const pieceLength = 2 * BlockSize
+	content := map[string][]byte{
+		"a":     bytes.Repeat([]byte("abcdefg"), 100000/7+1)[:100000],
+		"b":     bytes.Repeat([]byte("b"), 5000),
+		"c":     nil,
+		"sub/d": bytes.Repeat([]byte("0123456789"), 4000),
+	}
+	files := map[string]string{}
+	for name, data := range content {
+		files["v2/"+name] = string(data)
+	}
+	writeTestFiles(t, dir, files)
+
+	for _, version := range []Version{Hybrid, V2} {
+		b := Builder{Path: filepath.Join(dir, "v2"), PieceLength: pieceLength, Version: version}
+		mi, err := b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := mi.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if mi, err = Load(&buf); err != nil {
+			t.Fatal(err)
+		}
+		info, err := mi.UnmarshalInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.HasV2() || info.HasV1() != (version == Hybrid) {
+			t.Errorf("version %d: HasV1 %v, HasV2 %v", version, info.HasV1(), info.HasV2())
+		}
+		if n := info.NumPieces(); n != 4+1+0+2 {
+			t.Errorf("version %d: %d pieces", version, n)
+		}
+
+		layers := 0
+		for name, data := range content {
+			node := FileTree{Dir: info.FileTree}
+			for _, p := range strings.Split(name, "/") {
+				node = node.Dir[p]
+			}
+			if node.File == nil || node.File.Length != int64(len(data)) {
+				t.Errorf("version %d: %s: got %+v", version, name, node)
+				continue
+			}
+			root, layer := naiveTree(data, pieceLength)
+			if !bytes.Equal(node.File.PiecesRoot, root) {
+				t.Errorf("version %d: %s: pieces root %x, want %x", version, name, node.File.PiecesRoot, root)
+			}
+			if layer != nil {
+				layers++
+				if !bytes.Equal(mi.PieceLayers[string(root)], layer) {
+					t.Errorf("version %d: %s: wrong piece layer", version, name)
+				}
+			}
+		}
+		if layers != 2 || len(mi.PieceLayers) != layers {
+			t.Errorf("version %d: %d piece layers, want 2", version, len(mi.PieceLayers))
+		}
+
+		var names []string
+		for _, fi := range info.UpvertedFiles() {
+			names = append(names, strings.Join(fi.Path, "/"))
+		}
+		if version == V2 {
+			if want := []string{"a", "b", "c", "sub/d"}; !reflect.DeepEqual(names, want) {
+				t.Errorf("got files %q, want %q", names, want)
+			}
+			if info.TotalLength() != 145000 {
+				t.Errorf("total length %d", info.TotalLength())
+			}
+			continue
+		}
+
+		// The v1 view of a hybrid torrent pads each file to a piece boundary
+		want := []string{"a", ".pad/31072", "b", ".pad/27768", "c", "sub/d"}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("got files %q, want %q", names, want)
+		}
+		var v1 []byte
+		v1 = append(v1, content["a"]...)
+		v1 = append(v1, make([]byte, 31072)...)
+		v1 = append(v1, content["b"]...)
+		v1 = append(v1, make([]byte, 27768)...)
+		v1 = append(v1, content["sub/d"]...)
+		if !bytes.Equal(info.Pieces, expectedPieces(v1, pieceLength)) {
+			t.Error("v1 piece hashes of the hybrid torrent don't match")
+		}
+		if info.Files[1].Attr != "p" {
+			t.Errorf("padding file has attr %q", info.Files[1].Attr)
+		}
+	}
+}
+
+func TestBuilderV2SingleFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := bytes.Repeat([]byte("x"), 3*BlockSize+1)
+	writeTestFiles(t, dir, map[string]string{"f.iso": string(data)})
+
+	b := Builder{Path: filepath.Join(dir, "f.iso"), PieceLength: BlockSize, Version: V2}
+	mi, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IsDir() || info.TotalLength() != int64(len(data)) {
+		t.Errorf("got %+v", info)
+	}
+	files := info.UpvertedFiles()
+	root, _ := naiveTree(data, BlockSize)
+	if len(files) != 1 || files[0].Path != nil || !bytes.Equal(files[0].PiecesRoot, root) {
+		t.Errorf("got files %+v", files)
+	}
+	h := sha256.Sum256(mi.InfoBytes)
+	if v2 := mi.HashInfoBytesV2(); !bytes.Equal(v2[:], h[:]) || !bytes.Equal(v2.Truncate().Bytes(), h[:20]) {
+		t.Errorf("v2 infohash %s", v2)
+	}
+	if _, err := (&Builder{Path: b.Path, PieceLength: 1000, Version: V2}).Build(); err == nil {
+		t.Error("expected error for a piece length v2 doesn't allow")
+	}
+}
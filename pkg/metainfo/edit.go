@@ -0,0 +1,79 @@
+package metainfo
+
+import (
+	"bytes"
+
+	"github.com/Phantomape/bittorrent-client/pkg/bencode"
+)
+
+// The fields outside of the info dictionary, like the trackers, the comment
+// or the web seeds, can be changed freely: they don't take part in the
+// infohash, so the edited torrent is the same torrent to peers.
+
+// SetAnnounceList : replace the trackers. A single tracker only goes in
+// announce, like most tools write it. The infohash doesn't change.
+func (mi *MetaInfo) SetAnnounceList(al AnnounceList) {
+	mi.Announce, mi.AnnounceList = "", nil
+	urls := al.DistinctValues()
+	delete(urls, "")
+	// Clients without BEP 12 only know announce, give them the tracker the
+	// others try first
+first:
+	for _, tier := range al {
+		for _, u := range tier {
+			if u != "" {
+				mi.Announce = u
+				break first
+			}
+		}
+	}
+	if len(urls) > 1 {
+		mi.AnnounceList = al
+	}
+}
+
+// InfoEdit : changes to the info dictionary, nil fields are left alone
+type InfoEdit struct {
+	Private *bool   // set or clear the private flag, BEP 27
+	Source  *string // set the source tag, removed if empty
+}
+
+// EditInfo : apply e to the info dictionary, keeping the keys Info doesn't
+// know about. Unlike the other fields this derives a new torrent: the
+// infohash changes, so peers and trackers of the original don't know it.
+// It returns whether InfoBytes changed, they are left verbatim when e
+// changes nothing.
+func (mi *MetaInfo) EditInfo(e InfoEdit) (changed bool, err error) {
+	// Re-encoding sorts the keys, which would change the infohash of an info
+	// dictionary that isn't in canonical order
+	if e.Private == nil && e.Source == nil {
+		return
+	}
+	var dict map[string]bencode.Bytes
+	if err = bencode.Unmarshal(mi.InfoBytes, &dict); err != nil {
+		return
+	}
+	if e.Private != nil {
+		// A torrent that isn't private has no private key at all, some
+		// clients treat any value as private
+		if *e.Private {
+			dict["private"] = bencode.Bytes("i1e")
+		} else {
+			delete(dict, "private")
+		}
+	}
+	if e.Source != nil {
+		if *e.Source == "" {
+			delete(dict, "source")
+		} else if dict["source"], err = bencode.Marshal(*e.Source); err != nil {
+			return
+		}
+	}
+	infoBytes, err := bencode.Marshal(dict)
+	if err != nil {
+		return
+	}
+	changed = !bytes.Equal(infoBytes, mi.InfoBytes)
+	mi.InfoBytes = infoBytes
+	return
+}
@@ -0,0 +1,91 @@
+package metainfo
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSetAnnounceList(t *testing.T) {
+	var mi MetaInfo
+	mi.SetAnnounceList(AnnounceList{{"http://a/announce"}})
+	if mi.Announce != "http://a/announce" || mi.AnnounceList != nil {
+		t.Errorf("single tracker: got %q %q", mi.Announce, mi.AnnounceList)
+	}
+	mi.SetAnnounceList(AnnounceList{{"", "udp://b:80"}, {"udp://c:80"}})
+	if mi.Announce != "udp://b:80" || len(mi.AnnounceList) != 2 {
+		t.Errorf("tiers: got %q %q", mi.Announce, mi.AnnounceList)
+	}
+	mi.SetAnnounceList(nil)
+	if mi.Announce != "" || mi.AnnounceList != nil {
+		t.Errorf("no trackers: got %q %q", mi.Announce, mi.AnnounceList)
+	}
+}
+
+func TestEditInfo(t *testing.T) {
+	mi, err := LoadFromFile("../../test/data/debian-9.1.0-amd64-netinst.iso.torrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := append([]byte(nil), mi.InfoBytes...)
+	hash := mi.HashInfoBytes()
+
+	// Trackers and comment are outside of the info dictionary
+	mi.SetAnnounceList(AnnounceList{{"http://new/announce"}})
+	mi.Comment = "retargeted"
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if mi2, err := Load(&buf); err != nil || mi2.HashInfoBytes() != hash || mi2.Announce != "http://new/announce" {
+		t.Errorf("got %v, %v", mi2, err)
+	}
+
+	if changed, err := mi.EditInfo(InfoEdit{}); err != nil || changed {
+		t.Errorf("empty edit: changed %v, %v", changed, err)
+	}
+	private, source := true, "release"
+	if changed, err := mi.EditInfo(InfoEdit{Private: &private, Source: &source}); err != nil || !changed {
+		t.Fatalf("changed %v, %v", changed, err)
+	}
+	if mi.HashInfoBytes() == hash {
+		t.Error("infohash didn't change")
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsPrivate() || info.Source != "release" || info.Name != "debian-9.1.0-amd64-netinst.iso" {
+		t.Errorf("got %+v", info)
+	}
+
+	private, source = false, ""
+	if _, err := mi.EditInfo(InfoEdit{Private: &private, Source: &source}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(mi.InfoBytes, orig) {
+		t.Error("undoing the edit didn't give back the original info dictionary")
+	}
+}
+
+func TestEditTrackersKeepsUnsortedInfo(t *testing.T) {
+	// Keys out of order, re-encoding would sort them
+	info := "d4:name1:a6:lengthi1e12:piece lengthi16384e6:pieces20:" + string(make([]byte, 20)) + "e"
+	mi := MetaInfo{Announce: "http://old/announce", InfoBytes: []byte(info)}
+	hash := mi.HashInfoBytes()
+
+	mi.SetAnnounceList(AnnounceList{{"http://new/announce"}, {"udp://other:80"}})
+	if changed, err := mi.EditInfo(InfoEdit{}); err != nil || changed {
+		t.Errorf("empty edit: changed %v, %v", changed, err)
+	}
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	mi2, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(mi2.InfoBytes) != info || mi2.HashInfoBytes() != hash {
+		t.Errorf("info bytes changed: %q", mi2.InfoBytes)
+	}
+}
@@ -1,7 +1,51 @@
 package metainfo
 
+import "strings"
+
+// File attributes, BEP 47
+const (
+	AttrPadding    = 'p' // the file is zeros aligning the next file to a piece boundary
+	AttrExecutable = 'x'
+	AttrHidden     = 'h'
+	AttrSymlink    = 'l' // the file is a symlink to SymlinkPath, its length is 0
+)
+
 // FileInfo : information related to the file
 type FileInfo struct {
-	Length int64
-	Path   []string
+	Length      int64    `bencode:"length"`
+	Path        []string `bencode:"path"`
+	PathUTF8    []string `bencode:"path.utf-8,omitempty"`   // path in UTF-8 when path is in another encoding
+	MD5Sum      string   `bencode:"md5sum,omitempty"`       // hex MD5 of the file, optional
+	Attr        string   `bencode:"attr,omitempty"`         // file attributes, BEP 47
+	SymlinkPath []string `bencode:"symlink path,omitempty"` // target of a symlink, relative to the torrent root
+	SHA1        []byte   `bencode:"sha1,omitempty"`         // SHA-1 of the file, to find duplicates
+
+	// PiecesRoot is filled from the v2 file tree, it isn't part of the v1 file dictionary
+	PiecesRoot []byte `bencode:"-"`
+}
+
+// HasAttr : whether the file has the attribute a
+func (fi *FileInfo) HasAttr(a byte) bool {
+	return strings.IndexByte(fi.Attr, a) >= 0
+}
+
+// IsPadding : whether the file is a padding file, which clients don't write
+// to disk or show to users
+func (fi *FileInfo) IsPadding() bool {
+	return fi.HasAttr(AttrPadding)
+}
+
+// IsExecutable : whether the file should be made executable
+func (fi *FileInfo) IsExecutable() bool {
+	return fi.HasAttr(AttrExecutable)
+}
+
+// IsHidden : whether the file should be hidden
+func (fi *FileInfo) IsHidden() bool {
+	return fi.HasAttr(AttrHidden)
+}
+
+// IsSymlink : whether the file is a symlink to SymlinkPath
+func (fi *FileInfo) IsSymlink() bool {
+	return fi.HasAttr(AttrSymlink)
 }
@@ -0,0 +1,127 @@
+package metainfo
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/Phantomape/bittorrent-client/pkg/bencode"
+)
+
+// FileTree : a node of the v2 file tree, BEP 52. A directory maps names to
+// nodes; a file is a dictionary with the single empty key.
+type FileTree struct {
+	File *FileTreeFile       // set for files
+	Dir  map[string]FileTree // entries of a directory
+}
+
+// FileTreeFile : the leaf of the file tree describing one file
+type FileTreeFile struct {
+	Length     int64  `bencode:"length"`
+	PiecesRoot []byte `bencode:"pieces root,omitempty"` // merkle root of the file, absent for empty files
+}
+
+// MarshalBENCODE : encode the node as a file or directory dictionary
+func (ft FileTree) MarshalBENCODE() ([]byte, error) {
+	if ft.File != nil {
+		return bencode.Marshal(map[string]*FileTreeFile{"": ft.File})
+	}
+	if ft.Dir == nil {
+		return []byte("de"), nil
+	}
+	return bencode.Marshal(ft.Dir)
+}
+
+// UnmarshalBENCODE : decode a file or directory dictionary. The tree is
+// decoded in one pass, unmarshalling every level from its bytes would scan
+// deep trees over and over.
+func (ft *FileTree) UnmarshalBENCODE(b []byte) error {
+	var v interface{}
+	if err := bencode.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	return ft.fromValue(v)
+}
+
+// fromValue : set the node from its generic decoded form
+func (ft *FileTree) fromValue(v interface{}) error {
+	entries, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.New("file tree node is not a dictionary")
+	}
+	*ft = FileTree{}
+	if file, ok := entries[""]; ok {
+		if len(entries) != 1 {
+			return errors.New("file tree node is both a file and a directory")
+		}
+		ft.File = new(FileTreeFile)
+		return ft.File.fromValue(file)
+	}
+	ft.Dir = make(map[string]FileTree, len(entries))
+	for name, e := range entries {
+		var sub FileTree
+		if err := sub.fromValue(e); err != nil {
+			return err
+		}
+		ft.Dir[name] = sub
+	}
+	return nil
+}
+
+// fromValue : set the file from its generic decoded form, ignoring unknown
+// keys like Unmarshal does
+func (f *FileTreeFile) fromValue(v interface{}) error {
+	dict, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.New("file tree file is not a dictionary")
+	}
+	if l, ok := dict["length"]; ok {
+		if f.Length, ok = l.(int64); !ok {
+			return errors.New("file tree file length is not an integer")
+		}
+	}
+	if r, ok := dict["pieces root"]; ok {
+		root, ok := r.(string)
+		if !ok {
+			return errors.New("file tree pieces root is not a string")
+		}
+		f.PiecesRoot = []byte(root)
+	}
+	return nil
+}
+
+// Walk : call fn for every file under the node in the order of the
+// bencoded dictionaries, which is the order of the v1 file list
+func (ft FileTree) Walk(fn func(path []string, f *FileTreeFile)) {
+	ft.walk(nil, fn)
+}
+
+func (ft FileTree) walk(path []string, fn func([]string, *FileTreeFile)) {
+	if ft.File != nil {
+		fn(path, ft.File)
+		return
+	}
+	names := make([]string, 0, len(ft.Dir))
+	for name := range ft.Dir {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		// Copy so fn can keep the path
+		sub := append(path[:len(path):len(path)], name)
+		ft.Dir[name].walk(sub, fn)
+	}
+}
+
+// addFile : insert a file at path, creating directories on the way
+func (ft *FileTree) addFile(path []string, f *FileTreeFile) {
+	if len(path) == 0 {
+		ft.File = f
+		return
+	}
+	if ft.Dir == nil {
+		ft.Dir = make(map[string]FileTree)
+	}
+	sub := ft.Dir[path[0]]
+	sub.addFile(path[1:], f)
+	ft.Dir[path[0]] = sub
+}
@@ -0,0 +1,152 @@
+package metainfo
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// HashSize : length of a SHA-1 hash in bytes
+const HashSize = 20
+
+// Hash : 20-byte SHA-1 hash, used for infohashes and piece hashes
+type Hash [HashSize]byte
+
+// Bytes : return the hash as a byte slice
+func (h Hash) Bytes() []byte {
+	return h[:]
+}
+
+// AsString : return the raw bytes of the hash as a string
+func (h Hash) AsString() string {
+	return string(h[:])
+}
+
+// String : format the hash in hex
+func (h Hash) String() string {
+	return h.HexString()
+}
+
+// HexString : format the hash as 40 lowercase hex digits
+func (h Hash) HexString() string {
+	return hex.EncodeToString(h[:])
+}
+
+// Base32String : format the hash as 32 base32 characters, as in older magnet links
+func (h Hash) Base32String() string {
+	return base32.StdEncoding.EncodeToString(h[:])
+}
+
+// IsZero : check whether the hash is unset
+func (h Hash) IsZero() bool {
+	return h == Hash{}
+}
+
+// FromHexString : set the hash from 40 hex digits
+func (h *Hash) FromHexString(s string) error {
+	if len(s) != 2*HashSize {
+		return fmt.Errorf("hash hex string has bad length: %d", len(s))
+	}
+	n, err := hex.Decode(h[:], []byte(s))
+	if err != nil {
+		return err
+	}
+	if n != HashSize {
+		panic(n)
+	}
+	return nil
+}
+
+// FromBase32String : set the hash from 32 base32 characters, in either case
+func (h *Hash) FromBase32String(s string) error {
+	if len(s) != 32 {
+		return fmt.Errorf("hash base32 string has bad length: %d", len(s))
+	}
+	b, err := base32.StdEncoding.DecodeString(strings.ToUpper(s))
+	if err != nil {
+		return err
+	}
+	copy(h[:], b)
+	return nil
+}
+
+// ParseHash : parse a hash in hex or base32, the two forms found in magnet links
+func ParseHash(s string) (h Hash, err error) {
+	switch len(s) {
+	case 2 * HashSize:
+		err = h.FromHexString(s)
+	case 32:
+		err = h.FromBase32String(s)
+	default:
+		err = fmt.Errorf("hash string has bad length: %d", len(s))
+	}
+	return
+}
+
+// NewHashFromHex : parse a hash in hex, panics on bad input, for constants
+func NewHashFromHex(s string) (h Hash) {
+	if err := h.FromHexString(s); err != nil {
+		panic(err)
+	}
+	return
+}
+
+// HashBytes : compute the SHA-1 hash of b
+func HashBytes(b []byte) Hash {
+	return Hash(sha1.Sum(b))
+}
+
+// HashV2Size : length of a SHA-256 hash in bytes
+const HashV2Size = 32
+
+// HashV2 : 32-byte SHA-256 hash, used for v2 infohashes and merkle trees, BEP 52
+type HashV2 [HashV2Size]byte
+
+// Bytes : return the hash as a byte slice
+func (h HashV2) Bytes() []byte {
+	return h[:]
+}
+
+// AsString : return the raw bytes of the hash as a string
+func (h HashV2) AsString() string {
+	return string(h[:])
+}
+
+// String : format the hash in hex
+func (h HashV2) String() string {
+	return h.HexString()
+}
+
+// HexString : format the hash as 64 lowercase hex digits
+func (h HashV2) HexString() string {
+	return hex.EncodeToString(h[:])
+}
+
+// IsZero : check whether the hash is unset
+func (h HashV2) IsZero() bool {
+	return h == HashV2{}
+}
+
+// Truncate : the first 20 bytes, which stand in for the v2 infohash where
+// only 20 bytes fit, like the handshake and tracker requests
+func (h HashV2) Truncate() (ret Hash) {
+	copy(ret[:], h[:])
+	return
+}
+
+// FromHexString : set the hash from 64 hex digits
+func (h *HashV2) FromHexString(s string) error {
+	if len(s) != 2*HashV2Size {
+		return fmt.Errorf("hash hex string has bad length: %d", len(s))
+	}
+	_, err := hex.Decode(h[:], []byte(s))
+	return err
+}
+
+// HashBytesV2 : compute the SHA-256 hash of b
+func HashBytesV2(b []byte) HashV2 {
+	return HashV2(sha256.Sum256(b))
+}
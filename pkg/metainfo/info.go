@@ -1,10 +1,121 @@
 package metainfo
 
+import "github.com/Phantomape/bittorrent-client/pkg/bencode"
+
 // Info : the info dictionary
 type Info struct {
-	Name        string // suggested name for the file, purely advisory
-	Pieces      []byte // length is a multiple of 20
-	PieceLength int64  // number of bytes
-	Length      int64  // length of the file
-	Files       []FileInfo
+	Name        string              `bencode:"name"`                   // suggested name for the file, purely advisory
+	NameUTF8    string              `bencode:"name.utf-8,omitempty"`   // name in UTF-8 when name is in another encoding
+	Pieces      []byte              `bencode:"pieces,omitempty"`       // length is a multiple of 20, absent in v2 only torrents
+	PieceLength int64               `bencode:"piece length"`           // number of bytes
+	Length      int64               `bencode:"length,omitempty"`       // length of the file
+	MD5Sum      string              `bencode:"md5sum,omitempty"`       // hex MD5 of the file, optional
+	Attr        string              `bencode:"attr,omitempty"`         // attributes of the file, BEP 47
+	SymlinkPath []string            `bencode:"symlink path,omitempty"` // target of the file if it is a symlink
+	SHA1        []byte              `bencode:"sha1,omitempty"`         // SHA-1 of the file
+	Files       []FileInfo          `bencode:"files,omitempty"`        // v1 file list
+	MetaVersion int64               `bencode:"meta version,omitempty"` // 2 for v2 and hybrid torrents, BEP 52
+	FileTree    map[string]FileTree `bencode:"file tree,omitempty"`    // v2 file tree
+	Private     *bool               `bencode:"private,omitempty"`      // BEP 27, a pointer to keep an explicit 0
+	Source      string              `bencode:"source,omitempty"`       // tracker or site the torrent is for, changes the infohash
+}
+
+// MarshalBENCODE : encode the info dictionary. A v1 single file torrent
+// always has length and pieces, an empty file too: the omitempty tags are
+// for the fields absent from directories and v2 only torrents.
+func (info Info) MarshalBENCODE() ([]byte, error) {
+	type plainInfo Info // without this method
+	v := struct {
+		plainInfo
+		Length *int64  `bencode:"length,omitempty"`
+		Pieces *[]byte `bencode:"pieces,omitempty"`
+	}{plainInfo: plainInfo(info)}
+	if info.HasV1() {
+		v.Pieces = &info.Pieces
+		if len(info.Files) == 0 {
+			v.Length = &info.Length
+		}
+	} else if info.Length != 0 {
+		v.Length = &info.Length
+	}
+	return bencode.Marshal(v)
+}
+
+// HasV1 : whether the info has v1 metadata, true for hybrid torrents
+func (info *Info) HasV1() bool {
+	return info.MetaVersion != 2 || len(info.Pieces) != 0
+}
+
+// HasV2 : whether the info has v2 metadata, BEP 52
+func (info *Info) HasV2() bool {
+	return info.MetaVersion == 2
+}
+
+// IsDir : whether the torrent is a directory of files rather than a single file
+func (info *Info) IsDir() bool {
+	if info.HasV1() {
+		return len(info.Files) != 0
+	}
+	// A v2 single file torrent has one file named like the torrent
+	return len(info.FileTree) != 1 || info.FileTree[info.Name].File == nil
+}
+
+// IsPrivate : whether peers may only be found through the trackers, BEP 27
+func (info *Info) IsPrivate() bool {
+	return info.Private != nil && *info.Private
+}
+
+// TotalLength : length of the torrent data, summed over all files. For
+// hybrid torrents that includes the v1 padding files.
+func (info *Info) TotalLength() (ret int64) {
+	if info.HasV1() && !info.IsDir() {
+		return info.Length
+	}
+	for _, fi := range info.UpvertedFiles() {
+		ret += fi.Length
+	}
+	return
+}
+
+// UpvertedFiles : the files of the torrent, a single file torrent is returned
+// as one file with an empty path so callers handle both layouts the same way.
+// v2 only torrents are listed from the file tree.
+func (info *Info) UpvertedFiles() []FileInfo {
+	if !info.HasV1() {
+		return info.filesV2()
+	}
+	if !info.IsDir() {
+		return []FileInfo{{
+			Length:      info.Length,
+			MD5Sum:      info.MD5Sum,
+			Attr:        info.Attr,
+			SymlinkPath: info.SymlinkPath,
+			SHA1:        info.SHA1,
+		}}
+	}
+	return info.Files
+}
+
+// VisibleFiles : the files to show to users and write to disk, that is
+// UpvertedFiles without the padding files
+func (info *Info) VisibleFiles() (files []FileInfo) {
+	for _, fi := range info.UpvertedFiles() {
+		if !fi.IsPadding() {
+			files = append(files, fi)
+		}
+	}
+	return
+}
+
+// filesV2 : flatten the file tree in the order of the v1 file list
+func (info *Info) filesV2() (files []FileInfo) {
+	single := !info.IsDir()
+	FileTree{Dir: info.FileTree}.Walk(func(path []string, f *FileTreeFile) {
+		fi := FileInfo{Length: f.Length, Path: path, PiecesRoot: f.PiecesRoot}
+		if single {
+			fi.Path = nil
+		}
+		files = append(files, fi)
+	})
+	return
 }
@@ -0,0 +1,206 @@
+package metainfo
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Magnet : the parts of a magnet link the client uses, BEP 9, 53 and 52
+type Magnet struct {
+	InfoHash    Hash     // v1 infohash from xt=urn:btih, zero if absent
+	InfoHashV2  HashV2   // v2 infohash from xt=urn:btmh, zero if absent
+	DisplayName string   // dn
+	Trackers    []string // tr
+	WebSeeds    []string // ws, BEP 19
+	Peers       []string // x.pe, host:port of peers to connect to
+	SelectOnly  []int    // so, indices of the files to download, BEP 53
+
+	// Params holds the parameters not covered by the fields above
+	Params url.Values
+}
+
+const (
+	xtPrefixV1 = "urn:btih:"
+	xtPrefixV2 = "urn:btmh:"
+	// multihash prefix of a v2 infohash: SHA2-256, 32 bytes long
+	multihashSHA256 = "1220"
+	// maxSelectOnly bounds the indices a hostile so range can expand to
+	maxSelectOnly = 1 << 16
+)
+
+// ParseMagnet : parse a magnet URI, it needs at least one v1 or v2 infohash
+func ParseMagnet(uri string) (m Magnet, err error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return
+	}
+	if u.Scheme != "magnet" {
+		err = fmt.Errorf("bad magnet scheme %q", u.Scheme)
+		return
+	}
+	q, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return
+	}
+
+	for _, xt := range q["xt"] {
+		switch {
+		case strings.HasPrefix(xt, xtPrefixV1):
+			if m.InfoHash, err = ParseHash(xt[len(xtPrefixV1):]); err != nil {
+				err = fmt.Errorf("bad btih infohash: %s", err)
+				return
+			}
+		case strings.HasPrefix(xt, xtPrefixV2):
+			mh := xt[len(xtPrefixV2):]
+			if !strings.HasPrefix(mh, multihashSHA256) {
+				err = fmt.Errorf("unsupported btmh multihash %q", mh)
+				return
+			}
+			if err = m.InfoHashV2.FromHexString(mh[len(multihashSHA256):]); err != nil {
+				err = fmt.Errorf("bad btmh infohash: %s", err)
+				return
+			}
+		}
+	}
+	if m.InfoHash.IsZero() && m.InfoHashV2.IsZero() {
+		err = errors.New("magnet has no btih or btmh infohash")
+		return
+	}
+	delete(q, "xt")
+
+	m.DisplayName = q.Get("dn")
+	m.Trackers = q["tr"]
+	m.WebSeeds = q["ws"]
+	m.Peers = q["x.pe"]
+	if so := q.Get("so"); so != "" {
+		if m.SelectOnly, err = parseSelectOnly(so); err != nil {
+			return
+		}
+	}
+	for _, k := range []string{"dn", "tr", "ws", "x.pe", "so"} {
+		delete(q, k)
+	}
+	if len(q) != 0 {
+		m.Params = q
+	}
+	return
+}
+
+// parseSelectOnly : parse a list of indices and inclusive ranges like 0,2,4-6
+func parseSelectOnly(s string) (ret []int, err error) {
+	for _, part := range strings.Split(s, ",") {
+		first, last := part, part
+		if i := strings.IndexByte(part, '-'); i >= 0 {
+			first, last = part[:i], part[i+1:]
+		}
+		a, err := strconv.Atoi(first)
+		if err != nil || a < 0 {
+			return nil, fmt.Errorf("bad select-only index %q", part)
+		}
+		b, err := strconv.Atoi(last)
+		if err != nil || b < a {
+			return nil, fmt.Errorf("bad select-only range %q", part)
+		}
+		if b-a >= maxSelectOnly-len(ret) {
+			return nil, fmt.Errorf("select-only range %q is too large", part)
+		}
+		for i := a; i <= b; i++ {
+			ret = append(ret, i)
+		}
+	}
+	return
+}
+
+// formatSelectOnly : format sorted indices, collapsing runs into ranges
+func formatSelectOnly(indices []int) string {
+	indices = append([]int(nil), indices...)
+	sort.Ints(indices)
+	var parts []string
+	for i := 0; i < len(indices); {
+		j := i
+		for j+1 < len(indices) && indices[j+1] <= indices[j]+1 {
+			j++
+		}
+		if indices[j] == indices[i] {
+			parts = append(parts, strconv.Itoa(indices[i]))
+		} else {
+			parts = append(parts, strconv.Itoa(indices[i])+"-"+strconv.Itoa(indices[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// String : format the magnet URI. The infohashes come first and are left
+// unescaped, as other clients expect.
+func (m Magnet) String() string {
+	var params []string
+	add := func(k, v string) {
+		params = append(params, k+"="+url.QueryEscape(v))
+	}
+	if !m.InfoHash.IsZero() {
+		params = append(params, "xt="+xtPrefixV1+m.InfoHash.HexString())
+	}
+	if !m.InfoHashV2.IsZero() {
+		params = append(params, "xt="+xtPrefixV2+multihashSHA256+m.InfoHashV2.HexString())
+	}
+	if m.DisplayName != "" {
+		add("dn", m.DisplayName)
+	}
+	for _, tr := range m.Trackers {
+		add("tr", tr)
+	}
+	for _, ws := range m.WebSeeds {
+		add("ws", ws)
+	}
+	for _, pe := range m.Peers {
+		add("x.pe", pe)
+	}
+	if len(m.SelectOnly) != 0 {
+		params = append(params, "so="+formatSelectOnly(m.SelectOnly))
+	}
+	if len(m.Params) != 0 {
+		params = append(params, m.Params.Encode())
+	}
+	return "magnet:?" + strings.Join(params, "&")
+}
+
+// Magnet : the magnet link of the torrent, with its name, trackers and web
+// seeds. Both infohashes are included for hybrid torrents.
+func (mi *MetaInfo) Magnet() (m Magnet, err error) {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return
+	}
+	if info.HasV1() {
+		m.InfoHash = mi.HashInfoBytes()
+	}
+	if info.HasV2() {
+		m.InfoHashV2 = mi.HashInfoBytesV2()
+	}
+	m.DisplayName = info.Name
+	seen := make(map[string]bool)
+	for _, tier := range mi.UpvertedAnnounceList() {
+		for _, tr := range tier {
+			if tr != "" && !seen[tr] {
+				seen[tr] = true
+				m.Trackers = append(m.Trackers, tr)
+			}
+		}
+	}
+	m.WebSeeds = mi.URLList
+	return
+}
+
+// WireHash : the 20-byte hash identifying the torrent in handshakes and
+// tracker requests, the v1 infohash or else the truncated v2 one
+func (m Magnet) WireHash() Hash {
+	if !m.InfoHash.IsZero() {
+		return m.InfoHash
+	}
+	return m.InfoHashV2.Truncate()
+}
@@ -0,0 +1,101 @@
+package metainfo
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMagnet(t *testing.T) {
+	const uri = "magnet:?xt=urn:btih:fd5fdf21aef4505451861da97aa39000ed852988" +
+		"&dn=debian-9.1.0-amd64-netinst.iso" +
+		"&tr=http%3A%2F%2Fbttracker.debian.org%3A6969%2Fannounce&tr=udp%3A%2F%2Ftracker.example%3A80" +
+		"&ws=http%3A%2F%2Fcdimage.debian.org%2F" +
+		"&x.pe=10.0.0.1%3A6881&so=0,2,4-6&x.foo=bar"
+	m, err := ParseMagnet(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Magnet{
+		InfoHash:    NewHashFromHex("fd5fdf21aef4505451861da97aa39000ed852988"),
+		DisplayName: "debian-9.1.0-amd64-netinst.iso",
+		Trackers:    []string{"http://bttracker.debian.org:6969/announce", "udp://tracker.example:80"},
+		WebSeeds:    []string{"http://cdimage.debian.org/"},
+		Peers:       []string{"10.0.0.1:6881"},
+		SelectOnly:  []int{0, 2, 4, 5, 6},
+		Params:      url.Values{"x.foo": {"bar"}},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %+v, want %+v", m, want)
+	}
+	if s := m.String(); s != uri {
+		t.Errorf("String() = %s, want %s", s, uri)
+	}
+}
+
+func TestParseMagnetHashes(t *testing.T) {
+	v1 := NewHashFromHex("fd5fdf21aef4505451861da97aa39000ed852988")
+	var v2 HashV2
+	v2.FromHexString("caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa9f6105232b28ad099f3a302e")
+
+	m, err := ParseMagnet("magnet:?xt=urn:btih:" + v1.Base32String())
+	if err != nil || m.InfoHash != v1 {
+		t.Errorf("base32 btih: got %v, %v", m.InfoHash, err)
+	}
+	m, err = ParseMagnet("magnet:?xt=urn:btih:" + strings.ToLower(v1.Base32String()))
+	if err != nil || m.InfoHash != v1 {
+		t.Errorf("lowercase base32 btih: got %v, %v", m.InfoHash, err)
+	}
+
+	m, err = ParseMagnet("magnet:?xt=urn:btmh:1220" + v2.HexString())
+	if err != nil || m.InfoHashV2 != v2 || !m.InfoHash.IsZero() || m.WireHash() != v2.Truncate() {
+		t.Errorf("btmh: got %+v, %v", m, err)
+	}
+
+	hybrid := "magnet:?xt=urn:btih:" + v1.HexString() + "&xt=urn:btmh:1220" + v2.HexString()
+	m, err = ParseMagnet(hybrid)
+	if err != nil || m.InfoHash != v1 || m.InfoHashV2 != v2 || m.WireHash() != v1 {
+		t.Errorf("hybrid: got %+v, %v", m, err)
+	}
+	if m.String() != hybrid {
+		t.Errorf("String() = %s, want %s", m.String(), hybrid)
+	}
+
+	for _, bad := range []string{
+		"http://example.com/?xt=urn:btih:" + v1.HexString(),
+		"magnet:?dn=nohash",
+		"magnet:?xt=urn:btih:abcd",
+		"magnet:?xt=urn:btmh:1114" + v2.HexString(),
+		"magnet:?xt=urn:btih:" + v1.HexString() + "&so=3-1",
+		"magnet:?xt=urn:btih:" + v1.HexString() + "&so=0-999999999",
+	} {
+		if _, err := ParseMagnet(bad); err == nil {
+			t.Errorf("ParseMagnet(%q): expected error", bad)
+		}
+	}
+}
+
+func TestMetaInfoMagnet(t *testing.T) {
+	mi, err := LoadFromFile("../../test/data/bootstrap.dat.torrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := mi.Magnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.InfoHash.HexString() != "36719ba2cecf9f3bd7c5abfb7a88e939611b536c" || !m.InfoHashV2.IsZero() {
+		t.Errorf("got hashes %s %s", m.InfoHash, m.InfoHashV2)
+	}
+	if m.DisplayName != "bootstrap.dat" || len(m.Trackers) != 5 {
+		t.Errorf("got %+v", m)
+	}
+	m2, err := ParseMagnet(m.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m2, m) {
+		t.Errorf("round trip: got %+v, want %+v", m2, m)
+	}
+}
@@ -0,0 +1,70 @@
+package metainfo
+
+import (
+	"crypto/sha256"
+)
+
+// BlockSize : size of the leaves of v2 merkle trees, BEP 52
+const BlockSize = 16 << 10
+
+// merkleRoot : root of the merkle tree over hashes, padded with pad, the
+// root of a subtree of the same height over zeros. The tree is width leaves
+// wide, or the next power of two if hashes don't fit.
+func merkleRoot(hashes []HashV2, width int, pad HashV2) HashV2 {
+	if len(hashes) == 0 {
+		return HashV2{}
+	}
+	n := 1
+	for n < len(hashes) || n < width {
+		n *= 2
+	}
+	layer := make([]HashV2, n)
+	copy(layer, hashes)
+	for i := len(hashes); i < n; i++ {
+		layer[i] = pad
+	}
+	var buf [2 * HashV2Size]byte
+	for len(layer) > 1 {
+		for i := 0; i < len(layer)/2; i++ {
+			copy(buf[:], layer[2*i][:])
+			copy(buf[HashV2Size:], layer[2*i+1][:])
+			layer[i] = sha256.Sum256(buf[:])
+		}
+		layer = layer[:len(layer)/2]
+	}
+	return layer[0]
+}
+
+// zeroRoot : root of a merkle tree over blocks zero leaf hashes, blocks a
+// power of two. It pads piece layers, whose missing pieces are all zeros.
+func zeroRoot(blocks int) HashV2 {
+	var h HashV2
+	var buf [2 * HashV2Size]byte
+	for ; blocks > 1; blocks /= 2 {
+		copy(buf[:], h[:])
+		copy(buf[HashV2Size:], h[:])
+		h = sha256.Sum256(buf[:])
+	}
+	return h
+}
+
+// blockHashes : the leaf hashes of data, one per started block
+func blockHashes(data []byte) []HashV2 {
+	hashes := make([]HashV2, 0, (len(data)+BlockSize-1)/BlockSize)
+	for len(data) > 0 {
+		n := BlockSize
+		if n > len(data) {
+			n = len(data)
+		}
+		hashes = append(hashes, sha256.Sum256(data[:n]))
+		data = data[n:]
+	}
+	return hashes
+}
+
+// PiecesRoot : the pieces root of a file from its piece layer, the hashes of
+// its pieces. Only files larger than a piece have a piece layer, the root of
+// smaller ones is computed from their blocks directly.
+func PiecesRoot(pieceLayer []HashV2, pieceLength int64) HashV2 {
+	return merkleRoot(pieceLayer, 0, zeroRoot(int(pieceLength/BlockSize)))
+}
@@ -4,13 +4,25 @@ import (
 	"io"
 	"os"
 
-	"github.com/anacrolix/torrent/bencode"
+	"github.com/Phantomape/bittorrent-client/pkg/bencode"
 )
 
 // MetaInfo : data structure with the parsed data from torrent
 type MetaInfo struct {
-	Announce  string
-	InfoBytes bencode.Bytes
+	Announce     string        `bencode:"announce,omitempty"`
+	AnnounceList AnnounceList  `bencode:"announce-list,omitempty"` // tiers of trackers, BEP 12
+	Nodes        []Node        `bencode:"nodes,omitempty"`         // DHT bootstrap nodes, BEP 5
+	CreationDate int64         `bencode:"creation date,omitempty"` // seconds since the Unix epoch
+	Comment      string        `bencode:"comment,omitempty"`
+	CreatedBy    string        `bencode:"created by,omitempty"`
+	Encoding     string        `bencode:"encoding,omitempty"`  // encoding of the strings in info
+	URLList      URLList       `bencode:"url-list,omitempty"`  // web seeds, BEP 19
+	HTTPSeeds    []string      `bencode:"httpseeds,omitempty"` // HTTP seeds, BEP 17
+	InfoBytes    bencode.Bytes `bencode:"info"`                // the raw info dictionary, kept verbatim for hashing
+
+	// PieceLayers maps the pieces root of each file larger than a piece to
+	// the concatenated hashes of its pieces, BEP 52
+	PieceLayers map[string][]byte `bencode:"piece layers,omitempty"`
 }
 
 // Load : load the metainfo from an io.Reader
@@ -39,3 +51,31 @@ func (mi MetaInfo) UnmarshalInfo() (info Info, err error) {
 	err = bencode.Unmarshal(mi.InfoBytes, &info)
 	return
 }
+
+// HashInfoBytes : compute the infohash, the SHA-1 of the bencoded info dictionary
+func (mi MetaInfo) HashInfoBytes() Hash {
+	return HashBytes(mi.InfoBytes)
+}
+
+// HashInfoBytesV2 : compute the v2 infohash, the SHA-256 of the bencoded
+// info dictionary. Its truncated form identifies the torrent on the wire.
+func (mi MetaInfo) HashInfoBytesV2() HashV2 {
+	return HashBytesV2(mi.InfoBytes)
+}
+
+// Write : encode the metainfo to w
+func (mi MetaInfo) Write(w io.Writer) error {
+	return bencode.NewEncoder(w).Encode(mi)
+}
+
+// UpvertedAnnounceList : the tiers of trackers to announce to. As BEP 12
+// says, announce is only used when there is no announce-list.
+func (mi *MetaInfo) UpvertedAnnounceList() AnnounceList {
+	if mi.AnnounceList.OverridesAnnounce(mi.Announce) {
+		return mi.AnnounceList
+	}
+	if mi.Announce != "" {
+		return AnnounceList{{mi.Announce}}
+	}
+	return nil
+}
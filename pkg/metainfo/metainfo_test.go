@@ -0,0 +1,319 @@
+package metainfo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Phantomape/bittorrent-client/pkg/bencode"
+)
+
+func TestLoadFromFile(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		infoHash  string
+		numPieces int
+		length    int64
+		lastPiece int64
+		lastHash  string
+	}{
+		{
+			"../../test/data/bootstrap.dat.torrent",
+			"36719ba2cecf9f3bd7c5abfb7a88e939611b536c",
+			10761, 22566124235, 768715,
+			"f9285b19d6be215aa1206a377bb6b36982d4fdab",
+		},
+		{
+			"../../test/data/debian-9.1.0-amd64-netinst.iso.torrent",
+			"fd5fdf21aef4505451861da97aa39000ed852988",
+			1160, 304087040, 262144,
+			"9db457ebc715b490059fe94a7dac8e5be9881d37",
+		},
+	} {
+		mi, err := LoadFromFile(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h := mi.HashInfoBytes(); h.HexString() != tt.infoHash {
+			t.Errorf("%s: infohash %s, want %s", tt.name, h, tt.infoHash)
+		}
+		info, err := mi.UnmarshalInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := info.NumPieces(); n != tt.numPieces {
+			t.Errorf("%s: %d pieces, want %d", tt.name, n, tt.numPieces)
+		}
+		if l := info.TotalLength(); l != tt.length {
+			t.Errorf("%s: total length %d, want %d", tt.name, l, tt.length)
+		}
+		if fs := info.UpvertedFiles(); len(fs) != 1 || fs[0].Length != tt.length {
+			t.Errorf("%s: upverted files %v", tt.name, fs)
+		}
+
+		last := info.Piece(tt.numPieces - 1)
+		if last.Length != tt.lastPiece || last.Offset+last.Length != tt.length {
+			t.Errorf("%s: last piece %+v", tt.name, last)
+		}
+		if last.Hash.HexString() != tt.lastHash {
+			t.Errorf("%s: last piece hash %s, want %s", tt.name, last.Hash, tt.lastHash)
+		}
+		if first := info.Piece(0); first.Offset != 0 || first.Length != info.PieceLength {
+			t.Errorf("%s: first piece %+v", tt.name, first)
+		}
+	}
+}
+
+func TestMultiFileInfo(t *testing.T) {
+	info := Info{
+		PieceLength: 4,
+		Pieces:      make([]byte, 3*HashSize),
+		Files: []FileInfo{
+			{Length: 5, Path: []string{"a"}},
+			{Length: 5, Path: []string{"b", "c"}},
+		},
+	}
+	if info.TotalLength() != 10 {
+		t.Errorf("total length %d", info.TotalLength())
+	}
+	if p := info.Piece(2); p.Offset != 8 || p.Length != 2 {
+		t.Errorf("last piece %+v", p)
+	}
+	if fs := info.UpvertedFiles(); len(fs) != 2 {
+		t.Errorf("upverted files %v", fs)
+	}
+}
+
+func TestParseHash(t *testing.T) {
+	want := NewHashFromHex("fd5fdf21aef4505451861da97aa39000ed852988")
+	for _, s := range []string{
+		"fd5fdf21aef4505451861da97aa39000ed852988",
+		"FD5FDF21AEF4505451861DA97AA39000ED852988",
+		want.Base32String(),
+		strings.ToLower(want.Base32String()),
+	} {
+		h, err := ParseHash(s)
+		if err != nil {
+			t.Errorf("ParseHash(%q): %v", s, err)
+			continue
+		}
+		if h != want {
+			t.Errorf("ParseHash(%q) = %s, want %s", s, h, want)
+		}
+	}
+	for _, s := range []string{"", "fd5f", "zz5fdf21aef4505451861da97aa39000ed852988"} {
+		if _, err := ParseHash(s); err == nil {
+			t.Errorf("ParseHash(%q): expected error", s)
+		}
+	}
+}
+
+func TestRoundTripTorrentFiles(t *testing.T) {
+	for _, name := range []string{
+		"../../test/data/bootstrap.dat.torrent",
+		"../../test/data/debian-9.1.0-amd64-netinst.iso.torrent",
+	} {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mi, err := Load(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := mi.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Errorf("%s: encoding the metainfo changed it", name)
+		}
+
+		info, err := mi.UnmarshalInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := bencode.Marshal(info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, mi.InfoBytes) {
+			t.Errorf("%s: encoding the info changed it", name)
+		}
+	}
+
+	mi, _ := LoadFromFile("../../test/data/bootstrap.dat.torrent")
+	if mi.CreatedBy != "Transmission/2.82 (14160)" || mi.CreationDate != 1408820246 || mi.Encoding != "UTF-8" {
+		t.Errorf("got %+v", mi)
+	}
+	if len(mi.AnnounceList) != 5 || mi.UpvertedAnnounceList()[2][0] != "udp://coppersurfer.tk:6969/announce" {
+		t.Errorf("got announce list %q", mi.AnnounceList)
+	}
+	info, _ := mi.UnmarshalInfo()
+	if info.Private == nil || info.IsPrivate() {
+		t.Errorf("got private %v, want explicit 0", info.Private)
+	}
+}
+
+func TestRoundTripAllFields(t *testing.T) {
+	private := true
+	info := Info{
+		Name:        "dir",
+		Pieces:      make([]byte, HashSize),
+		PieceLength: 16384,
+		Files: []FileInfo{
+			{Length: 3, Path: []string{"a"}, MD5Sum: "900150983cd24fb0d6963f7d28e17f72"},
+		},
+		Private: &private,
+		Source:  "example",
+	}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi := MetaInfo{
+		Announce:     "http://a/announce",
+		AnnounceList: AnnounceList{{"http://a/announce", "http://b/announce"}, {"udp://c:80"}},
+		Nodes:        []Node{"router.example.com:6881", "[::1]:6882"},
+		CreationDate: 1500000000,
+		Comment:      "comment",
+		CreatedBy:    "bittorrent-client",
+		Encoding:     "UTF-8",
+		URLList:      URLList{"http://mirror/"},
+		HTTPSeeds:    []string{"http://seed/"},
+		InfoBytes:    infoBytes,
+	}
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	mi2, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*mi2, mi) {
+		t.Errorf("got %+v, want %+v", *mi2, mi)
+	}
+	info2, err := mi2.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(info2, info) {
+		t.Errorf("got %+v, want %+v", info2, info)
+	}
+}
+
+func TestURLListString(t *testing.T) {
+	for in, want := range map[string]URLList{
+		"d8:url-list5:http:e":       {"http:"},
+		"d8:url-list0:e":            nil,
+		"d8:url-listl1:a1:bee":      {"a", "b"},
+		"d8:url-listl1:ae4:infodee": {"a"},
+	} {
+		var mi MetaInfo
+		if err := bencode.Unmarshal([]byte(in), &mi); err != nil {
+			t.Errorf("%q: %v", in, err)
+			continue
+		}
+		if !reflect.DeepEqual(mi.URLList, want) {
+			t.Errorf("%q: got %q, want %q", in, mi.URLList, want)
+		}
+	}
+}
+
+func TestNodes(t *testing.T) {
+	var mi MetaInfo
+	err := bencode.Unmarshal([]byte("d5:nodesll9:127.0.0.1i6881eel3:::1i80eeee"), &mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Node{"127.0.0.1:6881", "[::1]:80"}; !reflect.DeepEqual(mi.Nodes, want) {
+		t.Errorf("got %q, want %q", mi.Nodes, want)
+	}
+	if err := bencode.Unmarshal([]byte("d5:nodesll1:aeee"), &mi); err == nil {
+		t.Error("expected error for a node without port")
+	}
+}
+
+func TestNumPiecesV2ZeroPieceLength(t *testing.T) {
+	var info Info
+	err := bencode.Unmarshal([]byte("d9:file treed1:xd0:d6:lengthi5eeee"+
+		"12:meta versioni2e4:name1:x12:piece lengthi0ee"), &info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := info.NumPieces(); n != 0 {
+		t.Errorf("%d pieces", n)
+	}
+	problems := info.Validate()
+	if len(problems) == 0 || problems[0].Kind != BadPieceLength {
+		t.Errorf("got %v", problems)
+	}
+}
+
+func TestFileTreeDeep(t *testing.T) {
+	const depth = 5000
+	var b bytes.Buffer
+	for i := 0; i < depth; i++ {
+		b.WriteString("d1:d")
+	}
+	b.WriteString("d0:d6:lengthi7e11:pieces root32:" + strings.Repeat("r", 32) + "ee")
+	b.WriteString(strings.Repeat("e", depth))
+
+	var ft FileTree
+	if err := bencode.Unmarshal(b.Bytes(), &ft); err != nil {
+		t.Fatal(err)
+	}
+	var files int
+	ft.Walk(func(path []string, f *FileTreeFile) {
+		files++
+		if len(path) != depth || f.Length != 7 || len(f.PiecesRoot) != 32 {
+			t.Errorf("file at depth %d: %+v", len(path), f)
+		}
+	})
+	if files != 1 {
+		t.Errorf("%d files", files)
+	}
+
+	if err := bencode.Unmarshal([]byte("d1:xd0:d6:length1:5eee"), &ft); err == nil {
+		t.Error("expected error for a length that isn't an integer")
+	}
+}
+
+func TestPieceDataLength(t *testing.T) {
+	// Padding files take no data, the second piece only has b in it
+	info := Info{
+		Name:        "d",
+		PieceLength: 8,
+		Pieces:      make([]byte, 2*HashSize),
+		Files: []FileInfo{
+			{Length: 5, Path: []string{"a"}},
+			{Length: 3, Path: []string{".pad", "3"}, Attr: "p"},
+			{Length: 4, Path: []string{"b"}},
+		},
+	}
+	if n := info.DataLength(); n != 9 {
+		t.Errorf("data length %d", n)
+	}
+	for i, want := range []int64{5, 4} {
+		if n := info.PieceDataLength(i); n != want {
+			t.Errorf("piece %d: %d bytes, want %d", i, n, want)
+		}
+	}
+
+	// v2 pieces end with their file
+	info = Info{Name: "d", PieceLength: 16384, MetaVersion: 2, FileTree: map[string]FileTree{
+		"a": {File: &FileTreeFile{Length: 20000}},
+		"b": {File: &FileTreeFile{Length: 100}},
+	}}
+	if n := info.DataLength(); n != 20100 {
+		t.Errorf("v2 data length %d", n)
+	}
+	for i, want := range []int64{16384, 3616, 100} {
+		if n := info.PieceDataLength(i); n != want {
+			t.Errorf("v2 piece %d: %d bytes, want %d", i, n, want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package metainfo
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/Phantomape/bittorrent-client/pkg/bencode"
+)
+
+// Node : a DHT bootstrap node as host:port, encoded as a [host, port] pair
+type Node string
+
+// MarshalBENCODE : encode the node as a [host, port] pair
+func (n Node) MarshalBENCODE() ([]byte, error) {
+	host, port, err := net.SplitHostPort(string(n))
+	if err != nil {
+		return nil, err
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("bad node port %q: %s", port, err)
+	}
+	return bencode.Marshal([]interface{}{host, p})
+}
+
+// UnmarshalBENCODE : decode a [host, port] pair
+func (n *Node) UnmarshalBENCODE(b []byte) error {
+	var pair []interface{}
+	if err := bencode.Unmarshal(b, &pair); err != nil {
+		return err
+	}
+	if len(pair) != 2 {
+		return fmt.Errorf("node has %d elements, want host and port", len(pair))
+	}
+	host, ok := pair[0].(string)
+	if !ok {
+		return fmt.Errorf("node host is %T, want string", pair[0])
+	}
+	port, ok := pair[1].(int64)
+	if !ok {
+		return fmt.Errorf("node port is %T, want integer", pair[1])
+	}
+	*n = Node(net.JoinHostPort(host, strconv.FormatInt(port, 10)))
+	return nil
+}
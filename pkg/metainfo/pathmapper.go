@@ -0,0 +1,189 @@
+package metainfo
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxComponentLength : longest file name, in bytes, most file systems accept
+const DefaultMaxComponentLength = 255
+
+// PathMapper : turns the file paths of torrents into relative local paths
+// that are safe to join to a download directory. Components can't climb out
+// of the directory, are valid UTF-8, fit in the file system limit and are
+// renamed so no two files collide, even on case-insensitive file systems.
+// A PathMapper remembers the paths it has returned, use one per directory.
+// The zero value is ready to use.
+type PathMapper struct {
+	MaxComponentLength int // in bytes, DefaultMaxComponentLength if zero
+
+	root *pathNode
+}
+
+// pathNode : a local directory, with the names already used in it
+type pathNode struct {
+	taken map[string]bool      // folded names of files and directories
+	dirs  map[string]*pathNode // subdirectories by their torrent name
+	names map[string]string    // local names of the subdirectories
+}
+
+// newPathNode : an empty directory
+func newPathNode() *pathNode {
+	return &pathNode{
+		taken: make(map[string]bool),
+		dirs:  make(map[string]*pathNode),
+		names: make(map[string]string),
+	}
+}
+
+// Map : the local path of the file at path in the torrent. Files in the same
+// torrent directory end up in the same local directory; a path mapped twice
+// gets two different local paths.
+func (m *PathMapper) Map(path []string) string {
+	if m.root == nil {
+		m.root = newPathNode()
+	}
+	if len(path) == 0 {
+		path = []string{""}
+	}
+	node := m.root
+	local := make([]string, len(path))
+	for i, c := range path[:len(path)-1] {
+		sub, ok := node.dirs[c]
+		if !ok {
+			sub = newPathNode()
+			node.dirs[c] = sub
+			node.names[c] = m.unique(node, c)
+		}
+		local[i] = node.names[c]
+		node = sub
+	}
+	local[len(path)-1] = m.unique(node, path[len(path)-1])
+	return filepath.Join(local...)
+}
+
+// MapFiles : the local paths of the files of info, in the order of
+// UpvertedFiles. Files of a directory torrent are under a directory named
+// like the torrent. The UTF-8 names are preferred when present. Padding
+// files get an empty path since they aren't written to disk.
+func (m *PathMapper) MapFiles(info *Info) []string {
+	name := info.Name
+	if info.NameUTF8 != "" && utf8.ValidString(info.NameUTF8) {
+		name = info.NameUTF8
+	}
+	files := info.UpvertedFiles()
+	ret := make([]string, len(files))
+	for i, fi := range files {
+		if fi.IsPadding() {
+			continue
+		}
+		if !info.IsDir() {
+			ret[i] = m.Map([]string{name})
+			continue
+		}
+		path := fi.Path
+		if len(fi.PathUTF8) != 0 && validUTF8(fi.PathUTF8) {
+			path = fi.PathUTF8
+		}
+		ret[i] = m.Map(append([]string{name}, path...))
+	}
+	return ret
+}
+
+// validUTF8 : whether all the components of path are valid UTF-8
+func validUTF8(path []string) bool {
+	for _, c := range path {
+		if !utf8.ValidString(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// unique : a safe local name for c that isn't taken in node yet, and take it
+func (m *PathMapper) unique(node *pathNode, c string) string {
+	max := m.MaxComponentLength
+	if max <= 0 {
+		max = DefaultMaxComponentLength
+	}
+	name := sanitizeComponent(c)
+	base, ext := name, filepath.Ext(name)
+	if ext == name || len(ext) > 16 {
+		ext = ""
+	}
+	base = base[:len(base)-len(ext)]
+
+	for n := 0; ; n++ {
+		suffix := ext
+		if n > 0 {
+			suffix = " (" + strconv.Itoa(n) + ")" + ext
+		}
+		local := base
+		if len(base)+len(suffix) > max {
+			// Cutting the name short mustn't leave a trailing dot or space
+			local = strings.TrimRight(truncateUTF8(base, max-len(suffix)), ". ")
+			if local == "" {
+				local = "_"
+			}
+		}
+		local += suffix
+		if key := strings.ToLower(local); !node.taken[key] {
+			node.taken[key] = true
+			return local
+		}
+	}
+}
+
+// sanitizeComponent : make c usable as a file name on common file systems
+func sanitizeComponent(c string) string {
+	var b strings.Builder
+	for i := 0; i < len(c); {
+		r, size := utf8.DecodeRuneInString(c[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			// Keep the byte visible, so names differing only by invalid
+			// bytes stay apart
+			b.WriteString("%" + strings.ToUpper(strconv.FormatUint(uint64(c[i]), 16)))
+		case r < 0x20 || r == 0x7f || strings.ContainsRune(`/\<>:"|?*`, r):
+			b.WriteByte('_')
+		default:
+			b.WriteRune(r)
+		}
+		i += size
+	}
+	s := b.String()
+
+	// Windows drops trailing dots and spaces, which would also turn ".." into
+	// a parent directory reference
+	if trimmed := strings.TrimRight(s, ". "); len(trimmed) != len(s) {
+		s = trimmed + strings.Repeat("_", len(s)-len(trimmed))
+	}
+	if s == "" {
+		return "_"
+	}
+	base := s
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if reservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+		s = "_" + s
+	}
+	return s
+}
+
+// truncateUTF8 : the longest prefix of s no longer than n bytes that doesn't
+// split a character
+func truncateUTF8(s string, n int) string {
+	if n < 1 {
+		n = 1
+	}
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
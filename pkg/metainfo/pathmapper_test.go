@@ -0,0 +1,78 @@
+package metainfo
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPathMapperMap(t *testing.T) {
+	var m PathMapper
+	for _, tt := range []struct {
+		path []string
+		want string
+	}{
+		{[]string{"dir", "a.txt"}, "dir/a.txt"},
+		{[]string{"dir", "A.TXT"}, "dir/A (1).TXT"},
+		{[]string{"dir", "a.txt"}, "dir/a (2).txt"},
+		{[]string{"..", "..", "etc", "passwd"}, "__/__/etc/passwd"},
+		{[]string{"/etc", "passwd"}, "_etc/passwd"},
+		{[]string{`C:\Windows`, "x"}, "C__Windows/x"},
+		{[]string{"a\x00b", "nul.txt", "con"}, "a_b/_nul.txt/_con"},
+		{[]string{"caf\xe9"}, "caf%E9"},
+		{[]string{"trailing. "}, "trailing__"},
+		{[]string{".hidden"}, ".hidden"},
+		{[]string{""}, "_"},
+		{nil, "_ (1)"},
+		// A file and a directory can't share a name
+		{[]string{"dir"}, "dir (1)"},
+		{[]string{"DIR", "b"}, "DIR (2)/b"},
+	} {
+		if got := filepath.ToSlash(m.Map(tt.path)); got != tt.want {
+			t.Errorf("Map(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPathMapperLongNames(t *testing.T) {
+	m := PathMapper{MaxComponentLength: 20}
+	long := strings.Repeat("é", 20) + ".mkv"
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		got := m.Map([]string{long})
+		if len(got) > 20 || !strings.HasSuffix(got, ".mkv") || seen[got] {
+			t.Errorf("Map(%q) = %q", long, got)
+		}
+		seen[got] = true
+	}
+	if got := m.Map([]string{"abcdefghijklmnopqrs. and more than twenty"}); got != "abcdefghijklmnopqrs" {
+		t.Errorf("Map left a trailing dot: %q", got)
+	}
+}
+
+func TestPathMapperMapFiles(t *testing.T) {
+	info := Info{
+		Name:     "t\xe9l\xe9",
+		NameUTF8: "télé",
+		Files: []FileInfo{
+			{Path: []string{"s\xe9rie", "1.mkv"}, PathUTF8: []string{"série", "1.mkv"}},
+			{Path: []string{"s\xe9rie", "2.mkv"}, PathUTF8: []string{"s\xe9rie", "2.mkv"}},
+			{Path: []string{"..", "x"}},
+		},
+	}
+	var m PathMapper
+	var got []string
+	for _, p := range m.MapFiles(&info) {
+		got = append(got, filepath.ToSlash(p))
+	}
+	want := []string{"télé/série/1.mkv", "télé/s%E9rie/2.mkv", "télé/__/x"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	info = Info{Name: "../../evil", Length: 1}
+	if got := m.MapFiles(&info); len(got) != 1 || got[0] != ".._.._evil" {
+		t.Errorf("single file: got %q", got)
+	}
+}
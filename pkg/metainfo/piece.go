@@ -0,0 +1,94 @@
+package metainfo
+
+// Piece : location and expected hash of a piece in the torrent data
+type Piece struct {
+	Index  int
+	Offset int64 // offset of the first byte in the concatenated files
+	Length int64 // equal to the piece length, except for the last piece
+	Hash   Hash  // expected SHA-1 of the piece data
+}
+
+// NumPieces : number of pieces the torrent data is split into. In v2 pieces
+// don't span files, so each file starts a new piece. A v2 torrent without a
+// valid piece length has none.
+func (info *Info) NumPieces() (n int) {
+	if info.HasV1() {
+		return len(info.Pieces) / HashSize
+	}
+	if info.PieceLength <= 0 {
+		return 0
+	}
+	for _, fi := range info.filesV2() {
+		n += int((fi.Length + info.PieceLength - 1) / info.PieceLength)
+	}
+	return
+}
+
+// Piece : return v1 piece i, panics if i is out of range like a slice index.
+// The hashes of v2 pieces are in the piece layers of the MetaInfo.
+func (info *Info) Piece(i int) Piece {
+	if i < 0 || i >= len(info.Pieces)/HashSize {
+		panic("metainfo: piece index out of range")
+	}
+	p := Piece{
+		Index:  i,
+		Offset: int64(i) * info.PieceLength,
+		Length: info.PieceLength,
+	}
+	copy(p.Hash[:], info.Pieces[i*HashSize:])
+	if end := info.TotalLength(); p.Offset+p.Length > end {
+		p.Length = end - p.Offset
+	}
+	return p
+}
+
+// DataLength : length of the torrent data without the padding files, what
+// a client downloads of it
+func (info *Info) DataLength() (ret int64) {
+	for _, fi := range info.VisibleFiles() {
+		ret += fi.Length
+	}
+	return
+}
+
+// PieceDataLength : bytes of piece i in files other than padding files. In
+// v2 torrents, which have no padding files, the last piece of each file is
+// short.
+func (info *Info) PieceDataLength(i int) int64 {
+	if info.HasV1() {
+		p := info.Piece(i)
+		var n, off int64
+		for _, fi := range info.UpvertedFiles() {
+			start, end := off, off+fi.Length
+			off = end
+			if fi.IsPadding() {
+				continue
+			}
+			if start < p.Offset {
+				start = p.Offset
+			}
+			if end > p.Offset+p.Length {
+				end = p.Offset + p.Length
+			}
+			if start < end {
+				n += end - start
+			}
+		}
+		return n
+	}
+	pl := info.PieceLength
+	if pl <= 0 {
+		return 0
+	}
+	for _, fi := range info.filesV2() {
+		n := int((fi.Length + pl - 1) / pl)
+		if i < n {
+			if rest := fi.Length - int64(i)*pl; rest < pl {
+				return rest
+			}
+			return pl
+		}
+		i -= n
+	}
+	return 0
+}
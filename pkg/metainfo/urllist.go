@@ -0,0 +1,28 @@
+package metainfo
+
+import (
+	"github.com/Phantomape/bittorrent-client/pkg/bencode"
+)
+
+// URLList : web seed URLs, BEP 19. Torrents with a single web seed often
+// store a string instead of a list, both are accepted.
+type URLList []string
+
+// UnmarshalBENCODE : decode a list of URLs or a single URL
+func (ul *URLList) UnmarshalBENCODE(b []byte) error {
+	if len(b) > 0 && b[0] == 'l' {
+		var l []string
+		err := bencode.Unmarshal(b, &l)
+		*ul = l
+		return err
+	}
+	var s string
+	if err := bencode.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*ul = nil
+	if s != "" {
+		*ul = URLList{s}
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package metainfo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProblemKind : the kind of defect Info.Validate found
+type ProblemKind int
+
+// Problem kinds
+const (
+	BadPieceLength     ProblemKind = iota + 1 // piece length isn't a power of two
+	BadPieces                                 // pieces isn't a whole number of SHA-1 hashes
+	PieceCountMismatch                        // number of piece hashes doesn't match the data length
+	LengthAndFiles                            // both length and files are set
+	BadLength                                 // negative file length
+	BadPath                                   // name or file path that is unsafe to map to storage
+	BadMetaVersion                            // unknown meta version or missing v2 file tree
+	HybridMismatch                            // v1 file list and v2 file tree describe different files
+	BadFileHash                               // sha1 of a file isn't a SHA-1 hash
+)
+
+var problemKindNames = map[ProblemKind]string{
+	BadPieceLength:     "bad piece length",
+	BadPieces:          "bad pieces",
+	PieceCountMismatch: "piece count mismatch",
+	LengthAndFiles:     "length and files",
+	BadLength:          "bad length",
+	BadPath:            "bad path",
+	BadMetaVersion:     "bad meta version",
+	HybridMismatch:     "hybrid mismatch",
+	BadFileHash:        "bad file hash",
+}
+
+// String : short description of the kind
+func (k ProblemKind) String() string {
+	if s, ok := problemKindNames[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("ProblemKind(%d)", int(k))
+}
+
+// Problem : one defect of an info dictionary
+type Problem struct {
+	Kind  ProblemKind
+	Field string // key path of the offending value, like files[3].path[1]
+	File  int    // index of the file in UpvertedFiles, -1 if the problem isn't about a file
+	Msg   string
+}
+
+// Error : the problem with the field it is about
+func (p Problem) Error() string {
+	return "metainfo: " + p.Field + ": " + p.Msg
+}
+
+// reservedNames : file names Windows refuses whatever their extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// checkPathComponent : why a name can't be used as one element of a path on
+// disk, or "" if it can
+func checkPathComponent(c string) string {
+	switch {
+	case c == "":
+		return "empty path component"
+	case c == "." || c == "..":
+		return fmt.Sprintf("path component %q refers to a directory", c)
+	case strings.IndexByte(c, 0) >= 0:
+		return fmt.Sprintf("path component %q contains a NUL byte", c)
+	case strings.ContainsAny(c, `/\`):
+		return fmt.Sprintf("path component %q contains a path separator", c)
+	case len(c) >= 2 && c[1] == ':' && ('a' <= c[0]|0x20 && c[0]|0x20 <= 'z'):
+		return fmt.Sprintf("path component %q is a drive letter", c)
+	}
+	base := c
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if reservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+		return fmt.Sprintf("path component %q is a reserved name", c)
+	}
+	return ""
+}
+
+// problemList : collects the problems found by Validate
+type problemList []Problem
+
+func (l *problemList) add(kind ProblemKind, field string, file int, format string, args ...interface{}) {
+	*l = append(*l, Problem{kind, field, file, fmt.Sprintf(format, args...)})
+}
+
+// Validate : check the info dictionary for defects that would make the
+// torrent unusable or unsafe to write to storage. It returns all the
+// problems found, nil if there are none.
+func (info *Info) Validate() []Problem {
+	var l problemList
+	if msg := checkPathComponent(info.Name); msg != "" {
+		l.add(BadPath, "name", -1, "%s", msg)
+	}
+
+	pieceLengthOK := info.PieceLength > 0 && info.PieceLength&(info.PieceLength-1) == 0
+	if !pieceLengthOK {
+		l.add(BadPieceLength, "piece length", -1, "piece length %d isn't a power of two", info.PieceLength)
+	} else if info.HasV2() && info.PieceLength < BlockSize {
+		l.add(BadPieceLength, "piece length", -1, "piece length %d is less than %d in a v2 torrent", info.PieceLength, BlockSize)
+		pieceLengthOK = false
+	}
+
+	switch info.MetaVersion {
+	case 0:
+	case 2:
+		if len(info.FileTree) == 0 {
+			l.add(BadMetaVersion, "file tree", -1, "meta version 2 without a file tree")
+		}
+	default:
+		l.add(BadMetaVersion, "meta version", -1, "unknown meta version %d", info.MetaVersion)
+	}
+
+	if info.HasV1() {
+		info.validateV1(&l, pieceLengthOK)
+	}
+	if info.HasV2() {
+		info.validateV2(&l)
+	}
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+// validateV1 : check the v1 piece hashes and file list
+func (info *Info) validateV1(l *problemList, pieceLengthOK bool) {
+	if len(info.Files) != 0 && info.Length != 0 {
+		l.add(LengthAndFiles, "length", -1, "both length and files are set")
+	}
+	lengthOK := true
+	if len(info.Files) == 0 && info.Length < 0 {
+		l.add(BadLength, "length", 0, "negative length %d", info.Length)
+		lengthOK = false
+	}
+	for i, fi := range info.Files {
+		field := fmt.Sprintf("files[%d]", i)
+		if fi.Length < 0 {
+			l.add(BadLength, field+".length", i, "negative length %d", fi.Length)
+			lengthOK = false
+		}
+		if len(fi.Path) == 0 {
+			l.add(BadPath, field+".path", i, "empty path")
+		}
+		for j, c := range fi.Path {
+			if msg := checkPathComponent(c); msg != "" {
+				l.add(BadPath, fmt.Sprintf("%s.path[%d]", field, j), i, "%s", msg)
+			}
+		}
+	}
+	for i, fi := range info.UpvertedFiles() {
+		field := fmt.Sprintf("files[%d]", i)
+		if !info.IsDir() {
+			field = ""
+		}
+		validateAttrs(l, field, i, &fi)
+	}
+
+	if len(info.Pieces)%HashSize != 0 {
+		l.add(BadPieces, "pieces", -1, "length %d isn't a multiple of %d", len(info.Pieces), HashSize)
+	} else if pieceLengthOK && lengthOK {
+		want := (info.TotalLength() + info.PieceLength - 1) / info.PieceLength
+		if got := int64(len(info.Pieces) / HashSize); got != want {
+			l.add(PieceCountMismatch, "pieces", -1, "%d piece hashes for %d bytes in %d pieces", got, info.TotalLength(), want)
+		}
+	}
+}
+
+// validateAttrs : check the BEP 47 fields of the file at index i, whose
+// dictionary is at field
+func validateAttrs(l *problemList, field string, i int, fi *FileInfo) {
+	key := func(k string) string {
+		if field == "" {
+			return k
+		}
+		return field + "." + k
+	}
+	if fi.SHA1 != nil && len(fi.SHA1) != HashSize {
+		l.add(BadFileHash, key("sha1"), i, "sha1 is %d bytes long", len(fi.SHA1))
+	}
+	if !fi.IsSymlink() {
+		return
+	}
+	if len(fi.SymlinkPath) == 0 {
+		l.add(BadPath, key("symlink path"), i, "symlink without a target")
+	}
+	for j, c := range fi.SymlinkPath {
+		if msg := checkPathComponent(c); msg != "" {
+			l.add(BadPath, fmt.Sprintf("%s[%d]", key("symlink path"), j), i, "%s", msg)
+		}
+	}
+}
+
+// validateV2 : check the v2 file tree and, for hybrid torrents, that it
+// describes the same files as the v1 file list
+func (info *Info) validateV2(l *problemList) {
+	// Problems are reported with the index of the file in UpvertedFiles,
+	// which for hybrid torrents is the v1 file list, padding included
+	var v1 []FileInfo
+	var v1Index []int
+	if info.HasV1() {
+		for i, fi := range info.UpvertedFiles() {
+			if !fi.IsPadding() {
+				v1 = append(v1, fi)
+				v1Index = append(v1Index, i)
+			}
+		}
+	}
+	index := func(i int) int {
+		if !info.HasV1() {
+			return i
+		}
+		if i < len(v1Index) {
+			return v1Index[i]
+		}
+		return -1
+	}
+
+	var files []FileInfo
+	FileTree{Dir: info.FileTree}.Walk(func(path []string, f *FileTreeFile) {
+		i := index(len(files))
+		name := strings.Join(path, "/")
+		if f.Length < 0 {
+			l.add(BadLength, "file tree", i, "file %q has negative length %d", name, f.Length)
+		}
+		if f.Length > 0 && len(f.PiecesRoot) != HashV2Size {
+			l.add(BadPieces, "file tree", i, "file %q has a pieces root of %d bytes", name, len(f.PiecesRoot))
+		}
+		for _, c := range path {
+			if msg := checkPathComponent(c); msg != "" {
+				l.add(BadPath, "file tree", i, "file %q: %s", name, msg)
+			}
+		}
+		files = append(files, FileInfo{Length: f.Length, Path: path})
+	})
+
+	if !info.HasV1() {
+		return
+	}
+	// The v1 file list of a hybrid torrent is the file tree with padding
+	// files in between. A single file is named like the torrent in the tree.
+	if !info.IsDir() && len(v1) == 1 {
+		v1[0].Path = []string{info.Name}
+	}
+	if len(v1) != len(files) {
+		l.add(HybridMismatch, "file tree", -1, "%d files in the v1 file list and %d in the file tree", len(v1), len(files))
+		return
+	}
+	for i := range v1 {
+		p1, p2 := strings.Join(v1[i].Path, "/"), strings.Join(files[i].Path, "/")
+		if p1 != p2 || v1[i].Length != files[i].Length {
+			l.add(HybridMismatch, "file tree", v1Index[i], "file %q of the v1 file list differs from %q in the file tree", p1, p2)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package metainfo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateTestTorrents(t *testing.T) {
+	names, err := filepath.Glob("../../test/data/*.torrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		mi, err := LoadFromFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := mi.UnmarshalInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if problems := info.Validate(); problems != nil {
+			t.Errorf("%s: %v", name, problems)
+		}
+	}
+}
+
+func TestValidateBuilt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestFiles(t, dir, map[string]string{
+		"v/a":     string(make([]byte, 40000)),
+		"v/b":     "",
+		"v/sub/c": "ccc",
+	})
+	for _, version := range []Version{V1, Hybrid, V2} {
+		info, err := (&Builder{Path: filepath.Join(dir, "v"), PieceLength: BlockSize, Version: version}).BuildInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if problems := info.Validate(); problems != nil {
+			t.Errorf("version %v: %v", version, problems)
+		}
+		if version != Hybrid {
+			continue
+		}
+		// Renaming a file in the v1 list only makes the two disagree
+		info.Files[len(info.Files)-1].Path = []string{"sub", "d"}
+		if problems := info.Validate(); len(problems) != 1 || problems[0].Kind != HybridMismatch || problems[0].File != len(info.Files)-1 {
+			t.Errorf("renamed hybrid file: %v", problems)
+		}
+	}
+}
+
+func TestValidateProblems(t *testing.T) {
+	info := Info{
+		Name:        "CON.txt",
+		Pieces:      make([]byte, 3*HashSize),
+		PieceLength: 1 << 14,
+		Length:      5,
+		Files: []FileInfo{
+			{Length: 1 << 14, Path: []string{"ok"}},
+			{Length: 1, Path: []string{"..", "etc", "passwd"}},
+			{Length: 2, Path: []string{"a\x00b"}},
+			{Length: 3, Path: []string{"/abs"}},
+			{Length: 4, Path: []string{"C:"}},
+			{Length: 5, Path: []string{"dir", ""}},
+			{Length: 6},
+		},
+	}
+	type found struct {
+		Kind  ProblemKind
+		Field string
+		File  int
+	}
+	var got []found
+	for _, p := range info.Validate() {
+		got = append(got, found{p.Kind, p.Field, p.File})
+	}
+	want := []found{
+		{BadPath, "name", -1},
+		{LengthAndFiles, "length", -1},
+		{BadPath, "files[1].path[0]", 1},
+		{BadPath, "files[2].path[0]", 2},
+		{BadPath, "files[3].path[0]", 3},
+		{BadPath, "files[4].path[0]", 4},
+		{BadPath, "files[5].path[1]", 5},
+		{BadPath, "files[6].path", 6},
+		{PieceCountMismatch, "pieces", -1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+
+	info = Info{Name: "x", PieceLength: 1 << 14, Attr: "l", SHA1: []byte("short"), SymlinkPath: []string{"..", "y"}}
+	got = nil
+	for _, p := range info.Validate() {
+		got = append(got, found{p.Kind, p.Field, p.File})
+	}
+	want = []found{{BadFileHash, "sha1", 0}, {BadPath, "symlink path[0]", 0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+
+	info = Info{Name: "x", Pieces: make([]byte, 21), PieceLength: 3 << 14, Length: 1}
+	got = nil
+	for _, p := range info.Validate() {
+		got = append(got, found{p.Kind, p.Field, p.File})
+	}
+	want = []found{{BadPieceLength, "piece length", -1}, {BadPieces, "pieces", -1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+
+	info = Info{Name: "x", PieceLength: 1 << 14, MetaVersion: 2, FileTree: map[string]FileTree{
+		"x": {File: &FileTreeFile{Length: 10, PiecesRoot: []byte("short")}},
+	}}
+	problems := info.Validate()
+	if len(problems) != 1 || problems[0].Kind != BadPieces || problems[0].File != 0 {
+		t.Errorf("v2 bad pieces root: %v", problems)
+	}
+	if s := problems[0].Error(); s != `metainfo: file tree: file "x" has a pieces root of 5 bytes` {
+		t.Errorf("Error() = %s", s)
+	}
+}
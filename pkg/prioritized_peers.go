@@ -1 +1,63 @@
 package bittorrentclient
+
+import (
+	"net"
+	"strconv"
+)
+
+// maxPeersPerTorrent : known peers kept for a torrent, the oldest are
+// forgotten beyond that
+const maxPeersPerTorrent = 500
+
+// Peer : a peer of a torrent that can be connected to
+type Peer struct {
+	IP     net.IP
+	Port   int
+	Source peerSource
+}
+
+// addr : the address to dial
+func (p Peer) addr() string {
+	return net.JoinHostPort(p.IP.String(), strconv.Itoa(p.Port))
+}
+
+// prioritizedPeers : the peers of a torrent it isn't connected to. The most
+// recently learnt come first, older addresses are likelier to be gone.
+type prioritizedPeers struct {
+	peers []Peer // oldest first
+	addrs map[string]bool
+}
+
+// Add : remember p, unless it is known already
+func (pp *prioritizedPeers) Add(p Peer) bool {
+	if pp.addrs == nil {
+		pp.addrs = make(map[string]bool)
+	}
+	addr := p.addr()
+	if pp.addrs[addr] {
+		return false
+	}
+	pp.addrs[addr] = true
+	pp.peers = append(pp.peers, p)
+	if len(pp.peers) > maxPeersPerTorrent {
+		delete(pp.addrs, pp.peers[0].addr())
+		pp.peers = pp.peers[1:]
+	}
+	return true
+}
+
+// PopMax : remove and return the peer to connect to first
+func (pp *prioritizedPeers) PopMax() (p Peer, ok bool) {
+	if len(pp.peers) == 0 {
+		return
+	}
+	p = pp.peers[len(pp.peers)-1]
+	pp.peers = pp.peers[:len(pp.peers)-1]
+	delete(pp.addrs, p.addr())
+	return p, true
+}
+
+// Len : number of peers
+func (pp *prioritizedPeers) Len() int {
+	return len(pp.peers)
+}
@@ -4,9 +4,8 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/Phantomape/bittorrent-client/pkg/metainfo"
 	"github.com/anacrolix/missinggo"
-
-	"github.com/anacrolix/torrent/metainfo"
 )
 
 // Header : fixed header for the beginning of handshake message
@@ -0,0 +1,41 @@
+package bittorrentclient
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Phantomape/bittorrent-client/pkg/tracker"
+)
+
+// TrackerScrape : what one tracker of a torrent says about its swarm
+type TrackerScrape struct {
+	URL string
+	tracker.ScrapeResult
+	Err error // the tracker couldn't be scraped
+}
+
+// Scrape : ask all the trackers of the torrent about its swarm at once,
+// without announcing. The results are in the order of the trackers.
+func (t *Torrent) Scrape(ctx context.Context) []TrackerScrape {
+	var ret []TrackerScrape
+	for _, tier := range t.Trackers() {
+		for _, u := range tier {
+			ret = append(ret, TrackerScrape{URL: u})
+		}
+	}
+	var wg sync.WaitGroup
+	for i := range ret {
+		wg.Add(1)
+		go func(ts *TrackerScrape) {
+			defer wg.Done()
+			res, err := tracker.ScrapeContext(ctx, ts.URL, t.infoHash)
+			if err != nil {
+				ts.Err = err
+				return
+			}
+			ts.ScrapeResult = res[0]
+		}(&ret[i])
+	}
+	wg.Wait()
+	return ret
+}
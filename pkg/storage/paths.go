@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"path/filepath"
+
+	"github.com/Phantomape/bittorrent-client/pkg/metainfo"
+)
+
+// FilePaths : where file based storage keeps the files of info under dir, in
+// the order of UpvertedFiles. The torrent paths go through a PathMapper so a
+// malicious torrent can't write outside dir. Padding files have an empty
+// path.
+func FilePaths(dir string, info *metainfo.Info) []string {
+	var m metainfo.PathMapper
+	paths := m.MapFiles(info)
+	for i, p := range paths {
+		if p != "" {
+			paths[i] = filepath.Join(dir, p)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"crypto/sha1"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/Phantomape/bittorrent-client/pkg/metainfo"
+)
+
+// VerifyPieces : hash the data of info kept under dir by file based storage,
+// and call fn with each piece that matches its hash. It returns the number
+// of pieces that match. v2 only torrents, whose pieces are checked against
+// the piece layers, aren't supported yet.
+func VerifyPieces(dir string, info *metainfo.Info, fn func(piece int)) (completed int, err error) {
+	if !info.HasV1() {
+		return 0, errors.New("verifying v2 only torrents isn't supported")
+	}
+	files := info.UpvertedFiles()
+	paths := FilePaths(dir, info)
+	buf := make([]byte, info.PieceLength)
+	for i := 0; i < info.NumPieces(); i++ {
+		p := info.Piece(i)
+		data := buf[:p.Length]
+		if readTorrentData(files, paths, p.Offset, data) != nil {
+			continue
+		}
+		if sha1.Sum(data) != p.Hash {
+			continue
+		}
+		completed++
+		fn(i)
+	}
+	return
+}
+
+// readTorrentData : read len(p) bytes at off in the torrent data from the
+// files at paths, padding files read as zeros
+func readTorrentData(files []metainfo.FileInfo, paths []string, off int64, p []byte) error {
+	for i, fi := range files {
+		if off >= fi.Length {
+			off -= fi.Length
+			continue
+		}
+		n := fi.Length - off
+		if n > int64(len(p)) {
+			n = int64(len(p))
+		}
+		if fi.IsPadding() {
+			for j := range p[:n] {
+				p[j] = 0
+			}
+		} else if err := readFileAt(paths[i], p[:n], off); err != nil {
+			return err
+		}
+		p, off = p[n:], 0
+		if len(p) == 0 {
+			return nil
+		}
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// readFileAt : fill p from the file at path, starting at off
+func readFileAt(path string, p []byte, off int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.ReadAt(p, off)
+	return err
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"crypto/sha1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Phantomape/bittorrent-client/pkg/metainfo"
+)
+
+func TestVerifyPieces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The padding file isn't on disk, it reads as zeros
+	info := &metainfo.Info{
+		Name:        "d",
+		PieceLength: 8,
+		Files: []metainfo.FileInfo{
+			{Length: 5, Path: []string{"a"}},
+			{Length: 3, Path: []string{".pad", "3"}, Attr: "p"},
+			{Length: 4, Path: []string{"b"}},
+			{Length: 8, Path: []string{"c"}},
+		},
+	}
+	for _, p := range []string{"abcde\x00\x00\x00", "bbbb", "cccccccc"} {
+		h := sha1.Sum([]byte(p))
+		info.Pieces = append(info.Pieces, h[:]...)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// b doesn't match, c is missing
+	for name, data := range map[string]string{"a": "abcde", "b": "bbbx"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, "d", name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var pieces []int
+	completed, err := VerifyPieces(dir, info, func(piece int) {
+		pieces = append(pieces, piece)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completed != 1 || !reflect.DeepEqual(pieces, []int{0}) {
+		t.Errorf("completed %d, pieces %v", completed, pieces)
+	}
+}
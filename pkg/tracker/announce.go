@@ -2,16 +2,18 @@ package tracker
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 
+	"github.com/Phantomape/bittorrent-client/pkg/bencode"
 	"github.com/anacrolix/dht/krpc"
 	"github.com/anacrolix/missinggo/httptoo"
-	"github.com/anacrolix/torrent/bencode"
 )
 
 // ErrBadScheme : customized error for unknown scheme
@@ -41,20 +43,27 @@ type AnnounceRequest struct {
 	Left       uint64 // Maybe use int64 for consistency
 	Uploaded   int64
 	Event      AnnounceEvent
-	IP         uint32
+	IP         uint32 // IPv4 address to announce instead of the one seen, if not 0
 	Port       uint16
-	Key        int32
-	NumWant    int32
+	Key        int32  // identifies the client when its IP changes, not sent if 0
+	NumWant    int32  // peers wanted, the tracker decides if 0
+	TrackerID  string // tracker id of the last response of the tracker, HTTP only
 }
 
 // AnnounceResponse : a response
 type AnnounceResponse struct {
-	Interval int32
-	Peers    []Peer
+	Interval    int32 // seconds until the next regular announce
+	MinInterval int32 // seconds announces must be apart at least, 0 if unknown
+	TrackerID   string
+	Seeders     int32
+	Leechers    int32
+	Warning     string // the announce succeeded, but the tracker has something to say
+	Peers       []Peer
 }
 
 // Announce : the abstraction for sending requests and receiving response
 type Announce struct {
+	Context    context.Context // cancels the announce, optional
 	TrackerURL string
 	Request    AnnounceRequest
 	UserAgent  string
@@ -62,9 +71,12 @@ type Announce struct {
 	HTTPClient *http.Client
 	ClientIPv4 krpc.NodeAddr // the struct combining ip and port
 	ClientIpv6 krpc.NodeAddr
+	// SupportCrypto : tell HTTP trackers the client accepts encrypted
+	// connections
+	SupportCrypto bool
 }
 
-// Do : sends an HTTP request and returns an HTTP response
+// Do : announce to the tracker over HTTP or UDP, BEP 3 and 15
 func (anc Announce) Do() (res AnnounceResponse, err error) {
 	trackerURL, err := url.Parse(anc.TrackerURL)
 	if err != nil {
@@ -74,9 +86,9 @@ func (anc Announce) Do() (res AnnounceResponse, err error) {
 	// We support http and udp
 	switch trackerURL.Scheme {
 	case "http", "https":
-		return
-	case "udp", "udp4", "udp6":
 		return announceHTTP(anc, trackerURL)
+	case "udp", "udp4", "udp6":
+		return announceUDP(anc, trackerURL)
 	default:
 		err = ErrBadScheme
 		return
@@ -84,12 +96,15 @@ func (anc Announce) Do() (res AnnounceResponse, err error) {
 }
 
 type httpResponse struct {
-	FailureReason string `bencode:"failure reason"`
-	Interval      int32  `bencode:"interval"`
-	TrackerID     string `bencode:"tracker id"`
-	Complete      int32  `bencode:"complete"`
-	Incomplete    int32  `bencode:"incomplete"`
-	Peers         []Peer `bencode:"peers"`
+	FailureReason  string `bencode:"failure reason"`
+	WarningMessage string `bencode:"warning message"`
+	Interval       int32  `bencode:"interval"`
+	MinInterval    int32  `bencode:"min interval"`
+	TrackerID      string `bencode:"tracker id"`
+	Complete       int32  `bencode:"complete"`
+	Incomplete     int32  `bencode:"incomplete"`
+	Peers          Peers  `bencode:"peers"`
+	Peers6         Peers6 `bencode:"peers6"`
 }
 
 func setAnnounceParams(trackerURL *url.URL, ar *AnnounceRequest, anc Announce) {
@@ -108,6 +123,24 @@ func setAnnounceParams(trackerURL *url.URL, ar *AnnounceRequest, anc Announce) {
 
 	// https://stackoverflow.com/questions/17418004/why-does-tracker-server-not-understand-my-request-bittorrent-protocol
 	q.Set("compact", "1")
+	// For trackers that ignore compact
+	q.Set("no_peer_id", "1")
+
+	if ar.NumWant != 0 {
+		q.Set("numwant", strconv.FormatInt(int64(ar.NumWant), 10))
+	}
+	if ar.Key != 0 {
+		q.Set("key", strconv.FormatUint(uint64(uint32(ar.Key)), 16))
+	}
+	if ar.IP != 0 {
+		q.Set("ip", net.IPv4(byte(ar.IP>>24), byte(ar.IP>>16), byte(ar.IP>>8), byte(ar.IP)).String())
+	}
+	if ar.TrackerID != "" {
+		q.Set("trackerid", ar.TrackerID)
+	}
+	if anc.SupportCrypto {
+		q.Set("supportcrypto", "1")
+	}
 
 	if anc.ClientIPv4.IP != nil {
 		q.Set("ipv4", anc.ClientIPv4.String())
@@ -119,25 +152,26 @@ func announceHTTP(anc Announce, trackerURL *url.URL) (res AnnounceResponse, err
 	trackerURL = httptoo.CopyURL(trackerURL) // Deep copy the url
 	setAnnounceParams(trackerURL, &anc.Request, anc)
 	req, err := http.NewRequest("GET", trackerURL.String(), nil)
+	if err != nil {
+		return
+	}
+	if anc.Context != nil {
+		req = req.WithContext(anc.Context)
+	}
 	req.Header.Set("User-Agent", anc.UserAgent)
 	req.Host = anc.HostHeader
-	resp, err := anc.HTTPClient.Do(req)
+	client := anc.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
 
-	var buf bytes.Buffer
-	io.Copy(&buf, resp.Body)
-	if resp.StatusCode != 200 {
-		err = fmt.Errorf("response from tracker: %s: %s", resp.Status, buf.String())
-		return
-	}
-
 	var trackerResponse httpResponse
-	err = bencode.Unmarshal(buf.Bytes(), &trackerResponse)
-	if err != nil {
-		err = fmt.Errorf("error decoding %q: %s", buf.Bytes(), err)
+	if err = decodeHTTPResponse(resp, &trackerResponse); err != nil {
 		return
 	}
 
@@ -148,6 +182,39 @@ func announceHTTP(anc Announce, trackerURL *url.URL) (res AnnounceResponse, err
 	}
 
 	res.Interval = trackerResponse.Interval
-	res.Peers = trackerResponse.Peers
+	res.MinInterval = trackerResponse.MinInterval
+	res.TrackerID = trackerResponse.TrackerID
+	res.Seeders = trackerResponse.Complete
+	res.Leechers = trackerResponse.Incomplete
+	res.Warning = trackerResponse.WarningMessage
+	res.Peers = append(trackerResponse.Peers, trackerResponse.Peers6...)
 	return
 }
+
+// Bounds on the HTTP tracker responses, a tracker is just another host on
+// the internet. A full peer list or a scrape of a few hundred torrents fits
+// well within them.
+const maxHTTPResponseLength = 2 << 20
+
+var httpResponseLimits = bencode.Limits{
+	MaxDepth:        32,
+	MaxStringLength: maxHTTPResponseLength,
+	MaxTotalBytes:   maxHTTPResponseLength,
+}
+
+// decodeHTTPResponse : decode the bencoded body of a tracker response into
+// v, reading no more than maxHTTPResponseLength bytes
+func decodeHTTPResponse(resp *http.Response, v interface{}) error {
+	body := io.LimitReader(resp.Body, maxHTTPResponseLength)
+	if resp.StatusCode != 200 {
+		var buf bytes.Buffer
+		io.Copy(&buf, io.LimitReader(body, 512))
+		return fmt.Errorf("response from tracker: %s: %s", resp.Status, buf.String())
+	}
+	dec := bencode.NewDecoder(body)
+	dec.SetLimits(httpResponseLimits)
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("error decoding tracker response: %w", err)
+	}
+	return nil
+}
@@ -2,12 +2,17 @@ package tracker
 
 import (
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/anacrolix/torrent/bencode"
+	"github.com/Phantomape/bittorrent-client/pkg/bencode"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -31,6 +36,24 @@ func TestUnmarshalHTTPResponsePeerDicts(t *testing.T) {
 	assert.NotNil(t, hr.Peers[1].IP)
 }
 
+func TestUnmarshalHTTPResponseMalformedPeer(t *testing.T) {
+	var hr httpResponse
+	require.NoError(t, bencode.Unmarshal(
+		[]byte("d8:intervali1800e5:peersl"+
+			"d2:ip7:1.2.3.44:porti6881ee"+
+			"d2:ip7:5.6.7.84:porti70000ee"+
+			"d2:ipi5e4:porti6882ee"+
+			"i3e"+
+			"d2:ip7:9.9.9.94:porti6883ee"+
+			"ee"),
+		&hr))
+
+	assert.EqualValues(t, 1800, hr.Interval)
+	require.Len(t, hr.Peers, 2)
+	assert.Equal(t, "1.2.3.4:6881", hr.Peers[0].String())
+	assert.Equal(t, "9.9.9.9:6883", hr.Peers[1].String())
+}
+
 func TestUnmarshalHttpResponseNoPeers(t *testing.T) {
 	var hr httpResponse
 	require.NoError(t, bencode.Unmarshal(
@@ -40,6 +63,115 @@ func TestUnmarshalHttpResponseNoPeers(t *testing.T) {
 	require.Len(t, hr.Peers, 0)
 }
 
+func TestUnmarshalHTTPResponseCompactPeers(t *testing.T) {
+	var hr httpResponse
+	require.NoError(t, bencode.Unmarshal(
+		[]byte("d5:peers12:\x01\x02\x03\x04\x1a\xe1\x05\x06\x07\x08\x1a\xe2"+
+			"6:peers618:\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x1a\xe3"+
+			"e"),
+		&hr))
+	require.Len(t, hr.Peers, 2)
+	assert.Equal(t, "1.2.3.4:6881", hr.Peers[0].String())
+	assert.Equal(t, "5.6.7.8:6882", hr.Peers[1].String())
+	assert.Nil(t, hr.Peers[0].ID)
+	require.Len(t, hr.Peers6, 1)
+	assert.Equal(t, "[2001:db8::1]:6883", hr.Peers6[0].String())
+
+	assert.Error(t, bencode.Unmarshal([]byte("d5:peers5:12345e"), &hr))
+	assert.Error(t, bencode.Unmarshal([]byte("d6:peers66:123456e"), &hr))
+}
+
+func TestAnnounceHTTPCompactPeers(t *testing.T) {
+	var query map[string][]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte("d8:intervali900e12:min intervali60e5:peers6:\x0a\x00\x00\x01\x1a\xe1e"))
+	}))
+	defer ts.Close()
+
+	res, err := Announce{
+		TrackerURL: ts.URL + "/announce",
+		Request:    AnnounceRequest{InfoHash: [20]byte{1}, Port: 6881},
+	}.Do()
+	require.NoError(t, err)
+	assert.EqualValues(t, 900, res.Interval)
+	assert.EqualValues(t, 60, res.MinInterval)
+	require.Len(t, res.Peers, 1)
+	assert.Equal(t, "10.0.0.1:6881", res.Peers[0].String())
+	assert.Equal(t, []string{"1"}, query["compact"])
+}
+
+func TestAnnounceHTTPResponseLimits(t *testing.T) {
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer ts.Close()
+	announce := Announce{TrackerURL: ts.URL + "/announce"}
+
+	// A peer list bigger than any tracker sends
+	body = []byte(fmt.Sprintf("d8:intervali900e5:peers%d:", 3<<20))
+	body = append(body, make([]byte, 3<<20)...)
+	body = append(body, 'e')
+	_, err := announce.Do()
+	assert.Error(t, err)
+
+	body = []byte("d8:intervali900e5:peers0:1:x" + strings.Repeat("l", 100) + strings.Repeat("e", 101))
+	_, err = announce.Do()
+	var le *bencode.LimitError
+	require.True(t, errors.As(err, &le), "%v", err)
+	assert.Equal(t, "MaxDepth", le.Limit)
+
+	// Garbage after the response is never read
+	body = []byte("d8:intervali900e5:peers0:e" + strings.Repeat("x", 3<<20))
+	res, err := announce.Do()
+	require.NoError(t, err)
+	assert.EqualValues(t, 900, res.Interval)
+}
+
+func TestAnnounceHTTPResponseFields(t *testing.T) {
+	var query url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte("d8:completei12e10:incompletei34e8:intervali900e12:min intervali60e" +
+			"10:tracker id3:abc15:warning message11:slow down!!5:peers0:e"))
+	}))
+	defer ts.Close()
+
+	res, err := Announce{
+		TrackerURL:    ts.URL + "/announce",
+		SupportCrypto: true,
+		Request: AnnounceRequest{
+			IP:        0x0a000001,
+			Key:       -2,
+			NumWant:   50,
+			TrackerID: "xyz",
+		},
+	}.Do()
+	require.NoError(t, err)
+	assert.Equal(t, AnnounceResponse{
+		Interval:    900,
+		MinInterval: 60,
+		TrackerID:   "abc",
+		Seeders:     12,
+		Leechers:    34,
+		Warning:     "slow down!!",
+	}, res)
+	assert.Equal(t, "50", query.Get("numwant"))
+	assert.Equal(t, "fffffffe", query.Get("key"))
+	assert.Equal(t, "10.0.0.1", query.Get("ip"))
+	assert.Equal(t, "xyz", query.Get("trackerid"))
+	assert.Equal(t, "1", query.Get("no_peer_id"))
+	assert.Equal(t, "1", query.Get("supportcrypto"))
+
+	// Parameters left to the tracker aren't sent
+	_, err = Announce{TrackerURL: ts.URL + "/announce"}.Do()
+	require.NoError(t, err)
+	for _, k := range []string{"numwant", "key", "ip", "trackerid", "supportcrypto"} {
+		assert.NotContains(t, query, k)
+	}
+}
+
 var defaultClient = &http.Client{
 	Timeout: time.Second * 15,
 	Transport: &http.Transport{
@@ -0,0 +1,298 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultAnnounceInterval : wait between announces if the tracker doesn't say
+	defaultAnnounceInterval = 30 * time.Minute
+	// announceRetryMin, announceRetryMax : wait after all the trackers failed,
+	// doubled each time they fail again
+	announceRetryMin = time.Minute
+	announceRetryMax = 30 * time.Minute
+	// announceTimeout : how long one tracker has to answer an announce
+	announceTimeout = time.Minute
+	// stoppedTimeout : how long the stopped announce may delay Run returning
+	stoppedTimeout = 5 * time.Second
+)
+
+var errNoTrackers = errors.New("no trackers")
+
+// AnnouncerTarget : the torrent an Announcer announces
+type AnnouncerTarget interface {
+	// AnnounceRequest : the request for the next announce, with the current
+	// transfer counters. The Announcer sets Event and TrackerID.
+	AnnounceRequest() AnnounceRequest
+	// AddPeers : the peers a tracker returned
+	AddPeers(peers []Peer)
+}
+
+// Status : how the announces to one tracker went
+type Status struct {
+	URL          string
+	Tier         int
+	LastAnnounce time.Time     // when the last announce was sent, zero if none was
+	Err          error         // why the last announce failed, nil if it succeeded
+	NextAnnounce time.Time     // when the tracker expects the next announce, zero if the last one failed
+	Interval     time.Duration // between regular announces, as of the last successful one
+	MinInterval  time.Duration // announces must be apart at least, 0 if unknown
+	Peers        int           // peers the last successful announce returned
+	Seeders      int32         // swarm as of the last successful announce
+	Leechers     int32
+	Warning      string // of the last successful announce
+
+	trackerID string // sent back to the tracker on the next announces
+}
+
+// Announcer : announces a torrent to its trackers, BEP 12. An announce goes
+// to the trackers tier by tier until one answers, that tracker then moves to
+// the front of its tier so the next announce tries it first. The trackers of
+// a tier start in random order.
+type Announcer struct {
+	target    AnnouncerTarget
+	completed chan struct{} // the torrent got all its pieces
+
+	mu     sync.Mutex
+	tiers  [][]string
+	status map[string]*Status // by URL
+
+	last string // tracker that answered the last announce, only used by Run
+}
+
+// NewAnnouncer : an Announcer for target without trackers
+func NewAnnouncer(target AnnouncerTarget) *Announcer {
+	return &Announcer{
+		target:    target,
+		completed: make(chan struct{}, 1),
+		status:    make(map[string]*Status),
+	}
+}
+
+// AddTiers : add the tiers of trackers the Announcer doesn't have yet, the
+// trackers it has are left out of them
+func (a *Announcer) AddTiers(tiers [][]string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	have := make(map[string]bool)
+	for _, tier := range a.tiers {
+		for _, u := range tier {
+			have[u] = true
+		}
+	}
+	for _, tier := range tiers {
+		var newTier []string
+		for _, u := range tier {
+			if !have[u] {
+				have[u] = true
+				newTier = append(newTier, u)
+			}
+		}
+		if len(newTier) != 0 {
+			rand.Shuffle(len(newTier), func(i, j int) {
+				newTier[i], newTier[j] = newTier[j], newTier[i]
+			})
+			a.tiers = append(a.tiers, newTier)
+		}
+	}
+}
+
+// Tiers : the announce URLs in tiers, in the order they are tried
+func (a *Announcer) Tiers() (tiers [][]string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, tier := range a.tiers {
+		tiers = append(tiers, append([]string(nil), tier...))
+	}
+	return
+}
+
+// Status : how the announces to each tracker went, in the order the trackers
+// are tried
+func (a *Announcer) Status() (ret []Status) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, tier := range a.tiers {
+		for _, u := range tier {
+			st := Status{URL: u}
+			if s, ok := a.status[u]; ok {
+				st = *s
+			}
+			st.Tier = i
+			ret = append(ret, st)
+		}
+	}
+	return
+}
+
+// Completed : the torrent got all its pieces, the trackers hear about it
+// with the next announce, sent as soon as their min interval allows
+func (a *Announcer) Completed() {
+	select {
+	case a.completed <- struct{}{}:
+	default:
+	}
+}
+
+// Run : announce until ctx is done, then tell the tracker that answered last
+// the torrent stopped
+func (a *Announcer) Run(ctx context.Context) {
+	event := Started
+	retry := announceRetryMin
+	for {
+		var next, earliest time.Time
+		st, err := a.announce(ctx, event)
+		if ctx.Err() != nil {
+			a.stopped()
+			return
+		}
+		if err == nil {
+			event = None
+			retry = announceRetryMin
+			next = st.NextAnnounce
+			earliest = st.LastAnnounce.Add(st.MinInterval)
+		} else {
+			next = time.Now().Add(retry)
+			earliest = next
+			if retry *= 2; retry > announceRetryMax {
+				retry = announceRetryMax
+			}
+		}
+
+		// Wait for the next announce, which comes sooner when the torrent
+		// completes, but not before the min interval
+		for wait := true; wait; {
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-timer.C:
+				wait = false
+			case <-a.completed:
+				// Trackers that never heard started don't need completed
+				if event == None {
+					event = Completed
+				}
+				if earliest.Before(next) {
+					next = earliest
+					a.setNext(a.last, next)
+				}
+			case <-ctx.Done():
+				timer.Stop()
+				a.stopped()
+				return
+			}
+			timer.Stop()
+		}
+	}
+}
+
+// setNext : record that the next announce to the tracker at u comes at next
+func (a *Announcer) setNext(u string, next time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if st, ok := a.status[u]; ok {
+		st.NextAnnounce = next
+	}
+}
+
+// announce : announce event to the trackers tier by tier until one answers,
+// and return the status of the one that did
+func (a *Announcer) announce(ctx context.Context, event AnnounceEvent) (st Status, err error) {
+	err = errNoTrackers
+	for _, tier := range a.Tiers() {
+		for _, u := range tier {
+			if ctx.Err() != nil {
+				return
+			}
+			tctx, cancel := context.WithTimeout(ctx, announceTimeout)
+			st, err = a.announceTo(tctx, u, event)
+			cancel()
+			if err == nil {
+				a.last = u
+				a.promote(u)
+				return
+			}
+		}
+	}
+	return
+}
+
+// promote : move the tracker at u to the front of its tier
+func (a *Announcer) promote(u string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, tier := range a.tiers {
+		for i, v := range tier {
+			if v == u {
+				copy(tier[1:i+1], tier[:i])
+				tier[0] = u
+				return
+			}
+		}
+	}
+}
+
+// stopped : tell the tracker that answered last the torrent stopped
+func (a *Announcer) stopped() {
+	if a.last == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stoppedTimeout)
+	defer cancel()
+	a.announceTo(ctx, a.last, Stopped)
+}
+
+// announceTo : announce event to the tracker at u, record how it went and
+// pass the peers it returned to the target
+func (a *Announcer) announceTo(ctx context.Context, u string, event AnnounceEvent) (ret Status, err error) {
+	req := a.target.AnnounceRequest()
+	req.Event = event
+	a.mu.Lock()
+	st, ok := a.status[u]
+	if !ok {
+		st = &Status{URL: u}
+		a.status[u] = st
+	}
+	req.TrackerID = st.trackerID
+	a.mu.Unlock()
+
+	sent := time.Now()
+	res, err := Announce{Context: ctx, TrackerURL: u, Request: req}.Do()
+
+	a.mu.Lock()
+	st.LastAnnounce = sent
+	st.Err = err
+	if err != nil {
+		st.NextAnnounce = time.Time{}
+		ret = *st
+		a.mu.Unlock()
+		return
+	}
+	st.Interval = time.Duration(res.Interval) * time.Second
+	st.MinInterval = time.Duration(res.MinInterval) * time.Second
+	if st.Interval <= 0 {
+		st.Interval = defaultAnnounceInterval
+	}
+	if st.Interval < st.MinInterval {
+		st.Interval = st.MinInterval
+	}
+	st.NextAnnounce = sent.Add(st.Interval)
+	st.Peers = len(res.Peers)
+	st.Seeders = res.Seeders
+	st.Leechers = res.Leechers
+	st.Warning = res.Warning
+	// A response without a tracker id keeps the previous one
+	if res.TrackerID != "" {
+		st.trackerID = res.TrackerID
+	}
+	ret = *st
+	a.mu.Unlock()
+
+	if event != Stopped {
+		a.target.AddPeers(res.Peers)
+	}
+	return
+}
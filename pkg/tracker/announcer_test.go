@@ -0,0 +1,158 @@
+package tracker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTarget : a torrent with left bytes to download
+type testTarget struct {
+	mu    sync.Mutex
+	left  uint64
+	peers []Peer
+}
+
+func (tt *testTarget) AnnounceRequest() AnnounceRequest {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	return AnnounceRequest{InfoHash: [20]byte{1}, Left: tt.left, Port: 6881}
+}
+
+func (tt *testTarget) AddPeers(peers []Peer) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	tt.peers = append(tt.peers, peers...)
+}
+
+// waitPeers : wait for n peers, the announces returning them are done then
+func (tt *testTarget) waitPeers(t *testing.T, n int) {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		tt.mu.Lock()
+		got := len(tt.peers)
+		tt.mu.Unlock()
+		if got >= n {
+			return
+		}
+	}
+	t.Fatalf("no %d peers", n)
+}
+
+func (tt *testTarget) setLeft(left uint64) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	tt.left = left
+}
+
+// trackerStub : an HTTP tracker passing the query of each announce to a
+// channel, and answering with response
+func trackerStub(response string) (*httptest.Server, chan url.Values) {
+	announces := make(chan url.Values, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		announces <- r.URL.Query()
+		w.Write([]byte(response))
+	}))
+	return ts, announces
+}
+
+func nextAnnounce(t *testing.T, announces chan url.Values) url.Values {
+	select {
+	case q := <-announces:
+		return q
+	case <-time.After(5 * time.Second):
+		t.Fatal("no announce")
+		return nil
+	}
+}
+
+// runAnnouncer : run a until the returned function is called
+func runAnnouncer(a *Announcer) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestAnnouncerEvents(t *testing.T) {
+	ts, announces := trackerStub("d8:intervali1800e5:peers6:\x0a\x00\x00\x01\x1a\xe1e")
+	defer ts.Close()
+	target := &testTarget{left: 20000}
+	a := NewAnnouncer(target)
+	a.AddTiers([][]string{{ts.URL + "/announce"}})
+	stop := runAnnouncer(a)
+
+	q := nextAnnounce(t, announces)
+	assert.Equal(t, "started", q.Get("event"))
+	assert.Equal(t, "20000", q.Get("left"))
+
+	// Without a min interval completed goes out right away
+	target.setLeft(0)
+	a.Completed()
+	q = nextAnnounce(t, announces)
+	assert.Equal(t, "completed", q.Get("event"))
+	assert.Equal(t, "0", q.Get("left"))
+
+	target.waitPeers(t, 2)
+	stop()
+	q = nextAnnounce(t, announces)
+	assert.Equal(t, "stopped", q.Get("event"))
+
+	// The peers of stopped aren't wanted anymore
+	assert.Len(t, target.peers, 2)
+	status := a.Status()
+	require.Len(t, status, 1)
+	assert.NoError(t, status[0].Err)
+	assert.Equal(t, 30*time.Minute, status[0].Interval)
+	assert.Equal(t, status[0].LastAnnounce.Add(30*time.Minute), status[0].NextAnnounce)
+}
+
+func TestAnnouncerTiers(t *testing.T) {
+	failed := make(chan url.Values, 10)
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failed <- r.URL.Query()
+		w.Write([]byte("d14:failure reason4:downe"))
+	}))
+	defer bad.Close()
+	good, announces := trackerStub("d8:intervali900e12:min intervali60e5:peers6:\x0a\x00\x00\x01\x1a\xe1e")
+	defer good.Close()
+
+	badURL, goodURL := bad.URL+"/announce", good.URL+"/announce"
+	target := &testTarget{}
+	a := NewAnnouncer(target)
+	a.AddTiers([][]string{{badURL}, {goodURL, badURL + "?2"}})
+	// Trackers it has already aren't added again
+	a.AddTiers([][]string{{goodURL}})
+	assert.Len(t, a.Tiers(), 2)
+	stop := runAnnouncer(a)
+
+	// The first tier fails, the second tier has the tracker that answers
+	assert.Equal(t, "started", nextAnnounce(t, failed).Get("event"))
+	assert.Equal(t, "started", nextAnnounce(t, announces).Get("event"))
+	target.waitPeers(t, 1)
+	stop()
+	assert.Equal(t, "stopped", nextAnnounce(t, announces).Get("event"))
+
+	// The tracker that answered is tried first in its tier from now on
+	assert.Equal(t, [][]string{{badURL}, {goodURL, badURL + "?2"}}, a.Tiers())
+	status := a.Status()
+	require.Len(t, status, 3)
+	assert.EqualError(t, status[0].Err, "down")
+	assert.True(t, status[0].NextAnnounce.IsZero())
+	assert.Equal(t, 1, status[1].Tier)
+	assert.NoError(t, status[1].Err)
+	assert.Equal(t, time.Minute, status[1].MinInterval)
+	assert.Equal(t, status[1].LastAnnounce.Add(15*time.Minute), status[1].NextAnnounce)
+}
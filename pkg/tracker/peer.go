@@ -1,9 +1,92 @@
 package tracker
 
-// Peer : a peer, the implementation data type for ip and port is different
-// across files in anacrolix's implementation, which should be a mistake
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/Phantomape/bittorrent-client/pkg/bencode"
+)
+
+// Peer : a peer returned by a tracker
 type Peer struct {
-	ID   []byte
-	IP   uint32
+	ID   []byte // absent from compact peer lists
+	IP   net.IP
 	Port uint16
 }
+
+// String : the address of the peer, host:port
+func (p Peer) String() string {
+	return net.JoinHostPort(p.IP.String(), strconv.Itoa(int(p.Port)))
+}
+
+// Peers : the peer list of a tracker response. It is either a list of
+// dictionaries, or with compact=1 a string of 6 bytes per IPv4 peer, BEP 23.
+type Peers []Peer
+
+// UnmarshalBENCODE : decode either form of the peer list
+func (ps *Peers) UnmarshalBENCODE(b []byte) error {
+	if len(b) > 0 && b[0] == 'l' {
+		var dicts []bencode.Bytes
+		if err := bencode.Unmarshal(b, &dicts); err != nil {
+			return err
+		}
+		*ps = (*ps)[:0]
+		for _, raw := range dicts {
+			// A malformed peer, like one with a port out of range, doesn't
+			// spoil the others
+			var d struct {
+				ID   []byte `bencode:"peer id"`
+				IP   string `bencode:"ip"`
+				Port uint16 `bencode:"port"`
+			}
+			if bencode.Unmarshal(raw, &d) != nil {
+				continue
+			}
+			// The ip can also be a DNS name, which Peer has no room for
+			if ip := net.ParseIP(d.IP); ip != nil {
+				*ps = append(*ps, Peer{ID: d.ID, IP: ip, Port: d.Port})
+			}
+		}
+		return nil
+	}
+	var s []byte
+	if err := bencode.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	peers, err := decodeCompactPeers(s, net.IPv4len)
+	*ps = peers
+	return err
+}
+
+// Peers6 : the peers6 list of a tracker response, a string of 18 bytes per
+// IPv6 peer, BEP 7
+type Peers6 []Peer
+
+// UnmarshalBENCODE : decode the compact IPv6 peers
+func (ps *Peers6) UnmarshalBENCODE(b []byte) error {
+	var s []byte
+	if err := bencode.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	peers, err := decodeCompactPeers(s, net.IPv6len)
+	*ps = peers
+	return err
+}
+
+// decodeCompactPeers : decode peers packed as an IP address of ipLen bytes
+// followed by a big endian port
+func decodeCompactPeers(b []byte, ipLen int) (peers []Peer, err error) {
+	size := ipLen + 2
+	if len(b)%size != 0 {
+		return nil, fmt.Errorf("compact peers of %d bytes are not a multiple of %d", len(b), size)
+	}
+	for ; len(b) > 0; b = b[size:] {
+		peers = append(peers, Peer{
+			IP:   net.IP(append([]byte(nil), b[:ipLen]...)),
+			Port: binary.BigEndian.Uint16(b[ipLen:]),
+		})
+	}
+	return
+}
@@ -0,0 +1,110 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrScrapeUnsupported : the tracker URL has no scrape counterpart
+var ErrScrapeUnsupported = errors.New("tracker does not support scrape")
+
+// ScrapeResult : the swarm of a torrent as a tracker sees it
+type ScrapeResult struct {
+	Seeders   int32
+	Leechers  int32
+	Completed int32 // downloads completed since the torrent was added
+}
+
+// Scrape : ask a tracker about the swarms of torrents without joining them.
+// The results are in the order of infoHashes; torrents the tracker doesn't
+// know have zero counts.
+func Scrape(trackerURL string, infoHashes ...[20]byte) ([]ScrapeResult, error) {
+	return ScrapeContext(context.Background(), trackerURL, infoHashes...)
+}
+
+// ScrapeContext : Scrape with a context to cancel it
+func ScrapeContext(ctx context.Context, trackerURL string, infoHashes ...[20]byte) ([]ScrapeResult, error) {
+	u, err := url.Parse(trackerURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return scrapeHTTP(ctx, u, infoHashes)
+	case "udp", "udp4", "udp6":
+		t, err := dialUDPTracker(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		defer t.Close()
+		return t.scrape(infoHashes)
+	default:
+		return nil, ErrBadScheme
+	}
+}
+
+// scrapeURL : the scrape URL of an HTTP tracker. By convention it is the
+// announce URL with the announce at the start of its last path element
+// replaced by scrape, BEP 48.
+func scrapeURL(announce *url.URL) (*url.URL, error) {
+	i := strings.LastIndexByte(announce.Path, '/')
+	if i < 0 || !strings.HasPrefix(announce.Path[i+1:], "announce") {
+		return nil, ErrScrapeUnsupported
+	}
+	u := *announce
+	u.Path = announce.Path[:i+1] + "scrape" + announce.Path[i+1+len("announce"):]
+	u.RawPath = ""
+	return &u, nil
+}
+
+type httpScrapeResponse struct {
+	FailureReason string `bencode:"failure reason"`
+	Files         map[string]struct {
+		Complete   int32 `bencode:"complete"`
+		Downloaded int32 `bencode:"downloaded"`
+		Incomplete int32 `bencode:"incomplete"`
+	} `bencode:"files"`
+}
+
+// scrapeHTTP : scrape an HTTP tracker
+func scrapeHTTP(ctx context.Context, announce *url.URL, infoHashes [][20]byte) (ret []ScrapeResult, err error) {
+	u, err := scrapeURL(announce)
+	if err != nil {
+		return
+	}
+	q := u.Query()
+	for _, ih := range infoHashes {
+		q.Add("info_hash", string(ih[:]))
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	var sr httpScrapeResponse
+	if err = decodeHTTPResponse(resp, &sr); err != nil {
+		return
+	}
+	if sr.FailureReason != "" {
+		err = errors.New(sr.FailureReason)
+		return
+	}
+	for _, ih := range infoHashes {
+		f := sr.Files[string(ih[:])]
+		ret = append(ret, ScrapeResult{
+			Seeders:   f.Complete,
+			Leechers:  f.Incomplete,
+			Completed: f.Downloaded,
+		})
+	}
+	return
+}
@@ -0,0 +1,80 @@
+package tracker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrapeURL(t *testing.T) {
+	for _, c := range []struct {
+		announce, scrape string
+	}{
+		{"http://example.com/announce", "http://example.com/scrape"},
+		{"http://example.com/x/announce", "http://example.com/x/scrape"},
+		{"http://example.com/announce.php", "http://example.com/scrape.php"},
+		{"http://example.com/announce?passkey=abc", "http://example.com/scrape?passkey=abc"},
+		{"http://example.com/a", ""},
+		{"http://example.com/announce/x", ""},
+		{"http://example.com", ""},
+	} {
+		u, err := url.Parse(c.announce)
+		require.NoError(t, err)
+		s, err := scrapeURL(u)
+		if c.scrape == "" {
+			assert.Equal(t, ErrScrapeUnsupported, err, c.announce)
+			continue
+		}
+		require.NoError(t, err, c.announce)
+		assert.Equal(t, c.scrape, s.String())
+	}
+}
+
+func TestScrapeHTTP(t *testing.T) {
+	var path string
+	var query url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query = r.URL.Path, r.URL.Query()
+		w.Write([]byte("d5:filesd" +
+			"20:\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00" +
+			"d8:completei5e10:downloadedi50e10:incompletei10ee" +
+			"ee"))
+	}))
+	defer ts.Close()
+
+	res, err := Scrape(ts.URL+"/announce", [20]byte{1}, [20]byte{2})
+	require.NoError(t, err)
+	assert.Equal(t, []ScrapeResult{{Seeders: 5, Leechers: 10, Completed: 50}, {}}, res)
+	assert.Equal(t, "/scrape", path)
+	require.Len(t, query["info_hash"], 2)
+	assert.Equal(t, "\x01"+string(make([]byte, 19)), query["info_hash"][0])
+	assert.Equal(t, "\x02"+string(make([]byte, 19)), query["info_hash"][1])
+}
+
+func TestScrapeHTTPFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("d14:failure reason17:scrape is privatee"))
+	}))
+	defer ts.Close()
+
+	_, err := Scrape(ts.URL+"/announce", [20]byte{1})
+	assert.EqualError(t, err, "scrape is private")
+	_, err = Scrape(ts.URL+"/tracker", [20]byte{1})
+	assert.Equal(t, ErrScrapeUnsupported, err)
+}
+
+func TestScrapeUDPMany(t *testing.T) {
+	s := newUDPTrackerStub(t)
+	defer s.Close()
+
+	res, err := Scrape(s.URL(), [20]byte{3}, [20]byte{4})
+	require.NoError(t, err)
+	assert.Equal(t, []ScrapeResult{
+		{Seeders: 3, Completed: 6, Leechers: 9},
+		{Seeders: 4, Completed: 8, Leechers: 12},
+	}, res)
+}
@@ -0,0 +1,286 @@
+package tracker
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// UDP tracker protocol, BEP 15
+
+const (
+	udpProtocolID = 0x41727101980 // magic number of connect requests
+
+	actionConnect  = 0
+	actionAnnounce = 1
+	actionScrape   = 2
+	actionError    = 3
+
+	// udpConnectionTTL : how long a connection ID can be used
+	udpConnectionTTL = 60 * time.Second
+	// udpMaxScrape : info hashes a single scrape request can carry
+	udpMaxScrape = 74
+)
+
+// Retransmission of requests: the nth attempt waits udpTimeout * 2^n for a
+// response, there are udpMaxAttempts attempts before giving up. Variables so
+// tests can speed them up.
+var (
+	udpTimeout     = 15 * time.Second
+	udpMaxAttempts = 9
+)
+
+// ErrUDPTimeout : the tracker didn't answer any of the retransmissions
+var ErrUDPTimeout = errors.New("udp tracker did not respond")
+
+// connIDs : connection IDs of UDP trackers by network and address, shared by
+// the announces and scrapes of all torrents
+var connIDs = struct {
+	sync.Mutex
+	m map[string]udpConnID
+}{m: make(map[string]udpConnID)}
+
+// udpConnID : a connection ID and when it stops being valid
+type udpConnID struct {
+	id      int64
+	expires time.Time
+}
+
+// udpTracker : an exchange with a UDP tracker
+type udpTracker struct {
+	ctx  context.Context
+	conn net.Conn
+	key  string // key in connIDs
+	buf  []byte // receives responses
+}
+
+// dialUDPTracker : open a socket to the tracker at u, the udp4 and udp6
+// schemes force the IP version
+func dialUDPTracker(ctx context.Context, u *url.URL) (*udpTracker, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	network := u.Scheme
+	if network != "udp4" && network != "udp6" {
+		network = "udp"
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, u.Host)
+	if err != nil {
+		return nil, err
+	}
+	return &udpTracker{
+		ctx:  ctx,
+		conn: conn,
+		key:  network + " " + u.Host,
+		buf:  make([]byte, 0x10000),
+	}, nil
+}
+
+// Close : close the socket
+func (t *udpTracker) Close() error {
+	return t.conn.Close()
+}
+
+// connectionID : a valid connection ID, from the cache or a connect request
+func (t *udpTracker) connectionID() (int64, error) {
+	connIDs.Lock()
+	c, ok := connIDs.m[t.key]
+	connIDs.Unlock()
+	if ok && time.Now().Before(c.expires) {
+		return c.id, nil
+	}
+
+	// The ID is valid from when the request is sent
+	sent := time.Now()
+	b, err := t.request(actionConnect, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(b) < 8 {
+		return 0, fmt.Errorf("udp tracker: connect response of %d bytes", len(b))
+	}
+	c = udpConnID{int64(binary.BigEndian.Uint64(b)), sent.Add(udpConnectionTTL)}
+	connIDs.Lock()
+	connIDs.m[t.key] = c
+	connIDs.Unlock()
+	return c.id, nil
+}
+
+// forgetConnectionID : drop the cached connection ID, the tracker may have
+// forgotten it
+func (t *udpTracker) forgetConnectionID() {
+	connIDs.Lock()
+	delete(connIDs.m, t.key)
+	connIDs.Unlock()
+}
+
+// request : send a request and return the body of the response, after the
+// action and transaction ID. Each attempt uses a new transaction ID so late
+// responses to earlier attempts are told apart, and gets a connection ID
+// again in case it expired while waiting.
+func (t *udpTracker) request(action int32, body []byte) ([]byte, error) {
+	// Closing the socket interrupts a read when ctx is done
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-t.ctx.Done():
+			t.conn.Close()
+		case <-stop:
+		}
+	}()
+
+	packet := make([]byte, 16+len(body))
+	copy(packet[16:], body)
+	for n := 0; n < udpMaxAttempts; n++ {
+		connID := int64(udpProtocolID)
+		if action != actionConnect {
+			var err error
+			if connID, err = t.connectionID(); err != nil {
+				return nil, err
+			}
+		}
+		tid := rand.Int31()
+		binary.BigEndian.PutUint64(packet, uint64(connID))
+		binary.BigEndian.PutUint32(packet[8:], uint32(action))
+		binary.BigEndian.PutUint32(packet[12:], uint32(tid))
+		if _, err := t.conn.Write(packet); err != nil {
+			return nil, t.ctxErr(err)
+		}
+
+		t.conn.SetReadDeadline(time.Now().Add(udpTimeout << uint(n)))
+		resp, err := t.readResponse(tid)
+		if err == nil {
+			return t.checkResponse(action, resp)
+		}
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() || t.ctx.Err() != nil {
+			return nil, t.ctxErr(err)
+		}
+	}
+	return nil, ErrUDPTimeout
+}
+
+// readResponse : read packets until one for transaction tid arrives
+func (t *udpTracker) readResponse(tid int32) ([]byte, error) {
+	for {
+		n, err := t.conn.Read(t.buf)
+		if err != nil {
+			return nil, err
+		}
+		if n >= 8 && int32(binary.BigEndian.Uint32(t.buf[4:])) == tid {
+			return t.buf[:n], nil
+		}
+	}
+}
+
+// checkResponse : the body of a response to action, or the error it reports
+func (t *udpTracker) checkResponse(action int32, resp []byte) ([]byte, error) {
+	switch got := int32(binary.BigEndian.Uint32(resp)); got {
+	case action:
+		return resp[8:], nil
+	case actionError:
+		if action != actionConnect {
+			t.forgetConnectionID()
+		}
+		return nil, errors.New(string(resp[8:]))
+	default:
+		return nil, fmt.Errorf("udp tracker: response action %d to request action %d", got, action)
+	}
+}
+
+// ctxErr : the error of the context if it interrupted the exchange
+func (t *udpTracker) ctxErr(err error) error {
+	if ctxErr := t.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// announce : send an announce request, BEP 15
+func (t *udpTracker) announce(ar *AnnounceRequest) (res AnnounceResponse, err error) {
+	body := make([]byte, 82)
+	copy(body, ar.InfoHash[:])
+	copy(body[20:], ar.PeerID[:])
+	binary.BigEndian.PutUint64(body[40:], uint64(ar.Downloaded))
+	binary.BigEndian.PutUint64(body[48:], ar.Left)
+	binary.BigEndian.PutUint64(body[56:], uint64(ar.Uploaded))
+	// The events have the values of the protocol
+	binary.BigEndian.PutUint32(body[64:], uint32(ar.Event))
+	binary.BigEndian.PutUint32(body[68:], ar.IP)
+	binary.BigEndian.PutUint32(body[72:], uint32(ar.Key))
+	numWant := ar.NumWant
+	if numWant == 0 {
+		numWant = -1 // let the tracker choose
+	}
+	binary.BigEndian.PutUint32(body[76:], uint32(numWant))
+	binary.BigEndian.PutUint16(body[80:], ar.Port)
+
+	b, err := t.request(actionAnnounce, body)
+	if err != nil {
+		return
+	}
+	if len(b) < 12 {
+		err = fmt.Errorf("udp tracker: announce response of %d bytes", len(b))
+		return
+	}
+	res.Interval = int32(binary.BigEndian.Uint32(b))
+	res.Leechers = int32(binary.BigEndian.Uint32(b[4:]))
+	res.Seeders = int32(binary.BigEndian.Uint32(b[8:]))
+	// The peers follow, of the IP version the announce was sent with
+	ipLen := net.IPv4len
+	if addr, ok := t.conn.RemoteAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil {
+		ipLen = net.IPv6len
+	}
+	b = b[12:]
+	res.Peers, err = decodeCompactPeers(b[:len(b)/(ipLen+2)*(ipLen+2)], ipLen)
+	return
+}
+
+// scrape : send scrape requests for infoHashes, BEP 15. The results are in
+// the same order.
+func (t *udpTracker) scrape(infoHashes [][20]byte) (ret []ScrapeResult, err error) {
+	for len(infoHashes) > 0 {
+		n := len(infoHashes)
+		if n > udpMaxScrape {
+			n = udpMaxScrape
+		}
+		body := make([]byte, 0, 20*n)
+		for _, ih := range infoHashes[:n] {
+			body = append(body, ih[:]...)
+		}
+		var b []byte
+		if b, err = t.request(actionScrape, body); err != nil {
+			return
+		}
+		if len(b) < 12*n {
+			err = fmt.Errorf("udp tracker: scrape response of %d bytes for %d torrents", len(b), n)
+			return
+		}
+		for i := 0; i < n; i++ {
+			ret = append(ret, ScrapeResult{
+				Seeders:   int32(binary.BigEndian.Uint32(b[12*i:])),
+				Completed: int32(binary.BigEndian.Uint32(b[12*i+4:])),
+				Leechers:  int32(binary.BigEndian.Uint32(b[12*i+8:])),
+			})
+		}
+		infoHashes = infoHashes[n:]
+	}
+	return
+}
+
+// announceUDP : announce to a udp:// tracker
+func announceUDP(anc Announce, trackerURL *url.URL) (res AnnounceResponse, err error) {
+	t, err := dialUDPTracker(anc.Context, trackerURL)
+	if err != nil {
+		return
+	}
+	defer t.Close()
+	return t.announce(&anc.Request)
+}
@@ -0,0 +1,270 @@
+package tracker
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// udpTrackerStub : an in-process UDP tracker answering BEP 15 requests
+type udpTrackerStub struct {
+	conn net.PacketConn
+
+	mu       sync.Mutex
+	connects int    // connect requests answered
+	drop     int    // requests to ignore before answering
+	fail     string // error message to answer announces with
+	announce []byte // body of the last announce request
+	connID   uint64
+}
+
+func newUDPTrackerStub(t *testing.T) *udpTrackerStub {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	return startUDPTrackerStub(conn)
+}
+
+func startUDPTrackerStub(conn net.PacketConn) *udpTrackerStub {
+	s := &udpTrackerStub{conn: conn, connID: 0x1122334455667788}
+	go s.serve()
+	return s
+}
+
+func (s *udpTrackerStub) URL() string {
+	return "udp://" + s.conn.LocalAddr().String() + "/announce"
+}
+
+func (s *udpTrackerStub) Close() {
+	s.conn.Close()
+}
+
+func (s *udpTrackerStub) serve() {
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.handle(buf[:n]); resp != nil {
+			s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *udpTrackerStub) handle(req []byte) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.drop > 0 {
+		s.drop--
+		return nil
+	}
+	connID := binary.BigEndian.Uint64(req)
+	action := binary.BigEndian.Uint32(req[8:])
+	body := req[16:]
+	resp := append([]byte(nil), req[8:16]...) // action and transaction ID
+	if action == actionConnect {
+		if connID != udpProtocolID {
+			return nil
+		}
+		s.connects++
+		resp = appendUint32(resp, uint32(s.connID>>32))
+		return appendUint32(resp, uint32(s.connID))
+	}
+	if connID != s.connID {
+		binary.BigEndian.PutUint32(resp, actionError)
+		return append(resp, "bad connection id"...)
+	}
+
+	switch action {
+	case actionAnnounce:
+		s.announce = append([]byte(nil), body...)
+		if s.fail != "" {
+			binary.BigEndian.PutUint32(resp, actionError)
+			return append(resp, s.fail...)
+		}
+		resp = appendUint32(resp, 1800) // interval
+		resp = appendUint32(resp, 3)    // leechers
+		resp = appendUint32(resp, 7)    // seeders
+		if s.conn.LocalAddr().(*net.UDPAddr).IP.To4() == nil {
+			return append(append(resp, net.ParseIP("2001:db8::1")...), 0x1a, 0xe1)
+		}
+		return append(resp, 10, 0, 0, 1, 0x1a, 0xe1, 10, 0, 0, 2, 0x1a, 0xe2)
+	case actionScrape:
+		for i := 0; i+20 <= len(body); i += 20 {
+			// Counts made up from the first byte of the info hash
+			resp = appendUint32(resp, uint32(body[i]))
+			resp = appendUint32(resp, uint32(body[i])*2)
+			resp = appendUint32(resp, uint32(body[i])*3)
+		}
+		return resp
+	}
+	return nil
+}
+
+// fastUDPRetransmit : make retransmissions quick, until the returned
+// function is called
+func fastUDPRetransmit() (restore func()) {
+	timeout, attempts := udpTimeout, udpMaxAttempts
+	udpTimeout, udpMaxAttempts = 20*time.Millisecond, 3
+	return func() { udpTimeout, udpMaxAttempts = timeout, attempts }
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func TestAnnounceUDP(t *testing.T) {
+	s := newUDPTrackerStub(t)
+	defer s.Close()
+
+	req := AnnounceRequest{
+		InfoHash:   [20]byte{1, 2, 3},
+		PeerID:     [20]byte{'-', 'G', 'T'},
+		Downloaded: 100,
+		Left:       200,
+		Uploaded:   300,
+		Event:      Started,
+		Key:        42,
+		Port:       6881,
+	}
+	res, err := Announce{TrackerURL: s.URL(), Request: req}.Do()
+	require.NoError(t, err)
+	assert.EqualValues(t, 1800, res.Interval)
+	assert.EqualValues(t, 7, res.Seeders)
+	assert.EqualValues(t, 3, res.Leechers)
+	require.Len(t, res.Peers, 2)
+	assert.Equal(t, "10.0.0.1:6881", res.Peers[0].String())
+	assert.Equal(t, "10.0.0.2:6882", res.Peers[1].String())
+
+	s.mu.Lock()
+	body := s.announce
+	s.mu.Unlock()
+	require.Len(t, body, 82)
+	assert.Equal(t, req.InfoHash[:], body[:20])
+	assert.Equal(t, req.PeerID[:], body[20:40])
+	assert.EqualValues(t, 100, binary.BigEndian.Uint64(body[40:]))
+	assert.EqualValues(t, 200, binary.BigEndian.Uint64(body[48:]))
+	assert.EqualValues(t, 300, binary.BigEndian.Uint64(body[56:]))
+	assert.EqualValues(t, 2, binary.BigEndian.Uint32(body[64:]), "started is event 2")
+	assert.EqualValues(t, 42, binary.BigEndian.Uint32(body[72:]))
+	assert.EqualValues(t, -1, int32(binary.BigEndian.Uint32(body[76:])), "default num_want")
+	assert.EqualValues(t, 6881, binary.BigEndian.Uint16(body[80:]))
+
+	// The connection ID is reused for a minute
+	_, err = Announce{TrackerURL: s.URL(), Request: req}.Do()
+	require.NoError(t, err)
+	s.mu.Lock()
+	assert.Equal(t, 1, s.connects)
+	s.mu.Unlock()
+}
+
+func TestAnnounceUDP6(t *testing.T) {
+	conn, err := net.ListenPacket("udp6", "[::1]:0")
+	if err != nil {
+		t.Skip("no IPv6:", err)
+	}
+	s := startUDPTrackerStub(conn)
+	defer s.Close()
+
+	res, err := Announce{TrackerURL: s.URL()}.Do()
+	require.NoError(t, err)
+	require.Len(t, res.Peers, 1)
+	assert.Equal(t, "[2001:db8::1]:6881", res.Peers[0].String())
+}
+
+func TestAnnounceUDPExpiredConnectionID(t *testing.T) {
+	s := newUDPTrackerStub(t)
+	defer s.Close()
+
+	_, err := Announce{TrackerURL: s.URL()}.Do()
+	require.NoError(t, err)
+	key := "udp " + s.conn.LocalAddr().String()
+	connIDs.Lock()
+	c := connIDs.m[key]
+	c.expires = time.Now().Add(-time.Second)
+	connIDs.m[key] = c
+	connIDs.Unlock()
+
+	_, err = Announce{TrackerURL: s.URL()}.Do()
+	require.NoError(t, err)
+	s.mu.Lock()
+	assert.Equal(t, 2, s.connects)
+	s.mu.Unlock()
+}
+
+func TestAnnounceUDPRetransmit(t *testing.T) {
+	defer fastUDPRetransmit()()
+	s := newUDPTrackerStub(t)
+	defer s.Close()
+
+	// Lose the first connect, then the first announce and its retransmission
+	s.mu.Lock()
+	s.drop = 1
+	s.mu.Unlock()
+	_, err := Announce{TrackerURL: s.URL()}.Do()
+	require.NoError(t, err)
+
+	s.mu.Lock()
+	s.drop = 2
+	s.mu.Unlock()
+	_, err = Announce{TrackerURL: s.URL()}.Do()
+	require.NoError(t, err)
+
+	s.mu.Lock()
+	s.drop = 100
+	s.mu.Unlock()
+	_, err = Announce{TrackerURL: s.URL()}.Do()
+	assert.Equal(t, ErrUDPTimeout, err)
+}
+
+func TestAnnounceUDPError(t *testing.T) {
+	s := newUDPTrackerStub(t)
+	defer s.Close()
+	s.mu.Lock()
+	s.fail = "torrent not registered"
+	s.mu.Unlock()
+
+	_, err := Announce{TrackerURL: s.URL()}.Do()
+	assert.EqualError(t, err, "torrent not registered")
+}
+
+func TestAnnounceUDPContext(t *testing.T) {
+	s := newUDPTrackerStub(t)
+	defer s.Close()
+	s.mu.Lock()
+	s.drop = 100
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, err := Announce{Context: ctx, TrackerURL: s.URL()}.Do()
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(started) < 5*time.Second)
+}
+
+func TestScrapeUDP(t *testing.T) {
+	s := newUDPTrackerStub(t)
+	defer s.Close()
+
+	var infoHashes [][20]byte
+	for i := 0; i < 100; i++ {
+		infoHashes = append(infoHashes, [20]byte{byte(i)})
+	}
+	u, err := url.Parse(s.URL())
+	require.NoError(t, err)
+	tr, err := dialUDPTracker(nil, u)
+	require.NoError(t, err)
+	defer tr.Close()
+	res, err := tr.scrape(infoHashes)
+	require.NoError(t, err)
+	require.Len(t, res, 100)
+	assert.Equal(t, ScrapeResult{Seeders: 99, Completed: 198, Leechers: 297}, res[99])
+}
@@ -0,0 +1,27 @@
+package bittorrentclient
+
+import (
+	"errors"
+
+	"github.com/Phantomape/bittorrent-client/pkg/storage"
+)
+
+// VerifyData : hash the data of the torrent in the download directory and
+// mark the pieces that match as completed, like after a restart. The trackers
+// hear the torrent completed once all the pieces are. It returns the number
+// of pieces that match, see storage.VerifyPieces.
+func (t *Torrent) VerifyData() (completed int, err error) {
+	t.c.rLock()
+	info := t.info
+	dir := t.c.config.dataDir
+	t.c.rUnlock()
+	if info == nil {
+		return 0, errors.New("torrent info not known yet")
+	}
+	// The files are read without the client locked, hashing takes a while
+	return storage.VerifyPieces(dir, info, func(piece int) {
+		t.c.lock()
+		t.pieceCompleted(piece)
+		t.c.unlock()
+	})
+}
@@ -1,10 +1,9 @@
 package main
 
 import (
-	"fmt"
-	"io/ioutil"
+	"os"
 
-	bencode "github.com/anacrolix/torrent/bencode"
+	"github.com/Phantomape/bittorrent-client/pkg/bencode"
 )
 
 func check(e error) {
@@ -13,15 +12,10 @@ func check(e error) {
 	}
 }
 
-func loadFile(name string) []byte {
-	data, err := ioutil.ReadFile(name)
-	check(err)
-	return data
-}
-
+// main : dump the sample torrent as JSON, binary strings like pieces are hex
 func main() {
-	data := loadFile("./bootstrap.dat.torrent")
-	var v interface{}
-	bencode.Unmarshal(data, &v)
-	fmt.Println(v)
+	f, err := os.Open("./bootstrap.dat.torrent")
+	check(err)
+	defer f.Close()
+	check(bencode.JSONOptions{Indent: "  "}.ToJSON(f, os.Stdout))
 }